@@ -1,10 +1,17 @@
 package netfilter
 
 import (
+	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"math"
+	"net"
+	"net/netip"
+	"slices"
 
 	"github.com/mdlayher/netlink"
+	"github.com/mdlayher/netlink/nlenc"
 )
 
 // NewAttributeDecoder instantiates a new netlink.AttributeDecoder
@@ -42,7 +49,12 @@ type Attribute struct {
 	Data []byte
 
 	// Whether the attribute's data contains nested attributes.
-	Nested   bool
+	Nested bool
+
+	// Nested attributes decoded from Data. Children are also populated for
+	// attributes without the Nested flag if they are listed in a NestingSchema.
+	// When encoding, non-nil Children take precedence over Data, and the
+	// Nested and NetByteOrder flags are set as given by Nested and NetByteOrder.
 	Children []Attribute
 
 	// Whether the attribute's data is in network (true) or native (false) byte order.
@@ -137,6 +149,109 @@ func (a Attribute) Int64() int64 {
 	return int64(a.Uint64())
 }
 
+// checkScalar returns an *AttributeError if an attribute with the given type,
+// nested flag and payload cannot be interpreted as a scalar of size bytes.
+func checkScalar(op string, typ uint16, nested bool, data []byte, size int) error {
+	if nested {
+		return &AttributeError{Op: op, Type: typ, Length: len(data), Err: ErrAttributeNested}
+	}
+
+	if len(data) != size {
+		return &AttributeError{Op: op, Type: typ, Length: len(data), Err: ErrAttributeLength}
+	}
+
+	return nil
+}
+
+// attributeError returns an *AttributeError for accessor op failing on a.
+func attributeError(op string, a Attribute, err error) error {
+	return &AttributeError{Op: op, Type: a.Type, Length: len(a.Data), Err: err}
+}
+
+// ParseUint16 interprets a non-nested Netfilter attribute in network byte order
+// as a uint16. Unlike Uint16, it returns an *AttributeError instead of panicking.
+func (a Attribute) ParseUint16() (uint16, error) {
+	if err := checkScalar("Uint16", a.Type, a.Nested, a.Data, 2); err != nil {
+		return 0, err
+	}
+
+	return binary.BigEndian.Uint16(a.Data), nil
+}
+
+// ParseUint32 interprets a non-nested Netfilter attribute in network byte order
+// as a uint32. Unlike Uint32, it returns an *AttributeError instead of panicking.
+func (a Attribute) ParseUint32() (uint32, error) {
+	if err := checkScalar("Uint32", a.Type, a.Nested, a.Data, 4); err != nil {
+		return 0, err
+	}
+
+	return binary.BigEndian.Uint32(a.Data), nil
+}
+
+// ParseUint64 interprets a non-nested Netfilter attribute in network byte order
+// as a uint64. Unlike Uint64, it returns an *AttributeError instead of panicking.
+func (a Attribute) ParseUint64() (uint64, error) {
+	if err := checkScalar("Uint64", a.Type, a.Nested, a.Data, 8); err != nil {
+		return 0, err
+	}
+
+	return binary.BigEndian.Uint64(a.Data), nil
+}
+
+// ParseInt32 converts the result of ParseUint32() to an int32.
+func (a Attribute) ParseInt32() (int32, error) {
+	v, err := a.ParseUint32()
+	return int32(v), err
+}
+
+// ParseInt64 converts the result of ParseUint64() to an int64.
+func (a Attribute) ParseInt64() (int64, error) {
+	v, err := a.ParseUint64()
+	return int64(v), err
+}
+
+// DecodeUint16 interprets the current attribute of ad in network byte order
+// as a uint16. In contrast to ad.Uint16, it returns an *AttributeError
+// carrying the attribute's type and length, and does not affect ad.Err.
+func DecodeUint16(ad *netlink.AttributeDecoder) (uint16, error) {
+	return attributeFromDecoder(ad).ParseUint16()
+}
+
+// DecodeUint32 interprets the current attribute of ad in network byte order
+// as a uint32. See DecodeUint16.
+func DecodeUint32(ad *netlink.AttributeDecoder) (uint32, error) {
+	return attributeFromDecoder(ad).ParseUint32()
+}
+
+// DecodeUint64 interprets the current attribute of ad in network byte order
+// as a uint64. See DecodeUint16.
+func DecodeUint64(ad *netlink.AttributeDecoder) (uint64, error) {
+	return attributeFromDecoder(ad).ParseUint64()
+}
+
+// DecodeInt32 converts the result of DecodeUint32 to an int32.
+func DecodeInt32(ad *netlink.AttributeDecoder) (int32, error) {
+	v, err := DecodeUint32(ad)
+	return int32(v), err
+}
+
+// DecodeInt64 converts the result of DecodeUint64 to an int64.
+func DecodeInt64(ad *netlink.AttributeDecoder) (int64, error) {
+	v, err := DecodeUint64(ad)
+	return int64(v), err
+}
+
+// attributeFromDecoder returns a non-recursive Attribute describing the
+// attribute ad currently points to.
+func attributeFromDecoder(ad *netlink.AttributeDecoder) Attribute {
+	return Attribute{
+		Type:         ad.Type(),
+		Data:         ad.Bytes(),
+		Nested:       ad.TypeFlags()&netlink.Nested != 0,
+		NetByteOrder: ad.TypeFlags()&netlink.NetByteOrder != 0,
+	}
+}
+
 // Uint16Bytes gets the big-endian 2-byte representation of a uint16.
 func Uint16Bytes(u uint16) []byte {
 	d := make([]byte, 2)
@@ -158,35 +273,124 @@ func Uint64Bytes(u uint64) []byte {
 	return d
 }
 
-// decode fills the Attribute's Children field with Attributes
-// obtained by exhausting ad.
-func (a *Attribute) decode(ad *netlink.AttributeDecoder) error {
-	for ad.Next() {
-		// Copy the netlink attribute's fields into the netfilter attribute.
-		nfa := Attribute{
-			// Only consider the rightmost 14 bits for Type.
-			// ad.Type implicitly masks the Nested and NetByteOrder bits.
-			Type: ad.Type(),
-			Data: ad.Bytes(),
-		}
+// ParseAddr interprets a non-nested attribute as an IPv4 or IPv6 address,
+// depending on whether its payload is 4 or 16 bytes long.
+func (a Attribute) ParseAddr() (netip.Addr, error) {
+	if a.Nested {
+		return netip.Addr{}, attributeError("Addr", a, ErrAttributeNested)
+	}
 
-		// Boolean flags extracted from the two leftmost bits of Type.
-		nfa.Nested = ad.TypeFlags()&netlink.Nested != 0
-		nfa.NetByteOrder = ad.TypeFlags()&netlink.NetByteOrder != 0
+	addr, ok := netip.AddrFromSlice(a.Data)
+	if !ok {
+		return netip.Addr{}, attributeError("Addr", a, ErrAttributeLength)
+	}
 
-		if nfa.NetByteOrder && nfa.Nested {
-			return errInvalidAttributeFlags
-		}
+	return addr, nil
+}
 
-		// Unmarshal recursively if the netlink Nested flag is set.
-		if nfa.Nested {
-			ad.Nested(nfa.decode)
-		}
+// PutAddr sets the Attribute's data field to the 4-byte representation of an
+// IPv4 address or the 16-byte representation of an IPv6 address. IPv4-mapped
+// IPv6 addresses are stored in their 16-byte form.
+func (a *Attribute) PutAddr(addr netip.Addr) {
+	a.Data = AddrBytes(addr)
+}
+
+// ParseString interprets a non-nested attribute as a string. The string ends
+// at the first NUL byte, if any.
+func (a Attribute) ParseString() (string, error) {
+	if a.Nested {
+		return "", attributeError("String", a, ErrAttributeNested)
+	}
+
+	if i := bytes.IndexByte(a.Data, 0); i >= 0 {
+		return string(a.Data[:i]), nil
+	}
+
+	return string(a.Data), nil
+}
+
+// PutString sets the Attribute's data field to a NUL-terminated string.
+func (a *Attribute) PutString(s string) {
+	a.Data = StringBytes(s)
+}
+
+// ParseHardwareAddr interprets a non-nested attribute as a hardware address.
+// The returned address is a copy of the attribute's data.
+func (a Attribute) ParseHardwareAddr() (net.HardwareAddr, error) {
+	if a.Nested {
+		return nil, attributeError("HardwareAddr", a, ErrAttributeNested)
+	}
+
+	if len(a.Data) == 0 {
+		return nil, attributeError("HardwareAddr", a, ErrAttributeLength)
+	}
+
+	return HardwareAddrBytes(a.Data), nil
+}
+
+// PutHardwareAddr sets the Attribute's data field to a copy of a hardware address.
+func (a *Attribute) PutHardwareAddr(hw net.HardwareAddr) {
+	a.Data = HardwareAddrBytes(hw)
+}
 
-		a.Children = append(a.Children, nfa)
+// Bitfield32 is the payload of an NLA_BITFIELD32 attribute (struct nla_bitfield32).
+// Only the bits of Value that are also set in Selector are meaningful.
+type Bitfield32 struct {
+	Value    uint32
+	Selector uint32
+}
+
+// ParseBitfield32 interprets a non-nested attribute as a Bitfield32. Unlike
+// other Netfilter attributes, struct nla_bitfield32 is in native byte order.
+func (a Attribute) ParseBitfield32() (Bitfield32, error) {
+	if err := checkScalar("Bitfield32", a.Type, a.Nested, a.Data, 8); err != nil {
+		return Bitfield32{}, err
 	}
 
-	return ad.Err()
+	return Bitfield32{
+		Value:    nlenc.Uint32(a.Data[0:4]),
+		Selector: nlenc.Uint32(a.Data[4:8]),
+	}, nil
+}
+
+// PutBitfield32 sets the Attribute's data field to a Bitfield32 encoded in
+// native byte order.
+func (a *Attribute) PutBitfield32(bf Bitfield32) {
+	a.Data = Bitfield32Bytes(bf)
+}
+
+// AddrBytes gets the 4-byte representation of an IPv4 address or the 16-byte
+// representation of an IPv6 address. Returns nil for the zero Addr.
+func AddrBytes(addr netip.Addr) []byte {
+	return addr.AsSlice()
+}
+
+// StringBytes gets the NUL-terminated representation of a string.
+func StringBytes(s string) []byte {
+	d := make([]byte, len(s)+1)
+	copy(d, s)
+	return d
+}
+
+// HardwareAddrBytes gets a copy of the representation of a hardware address.
+func HardwareAddrBytes(hw net.HardwareAddr) []byte {
+	d := make([]byte, len(hw))
+	copy(d, hw)
+	return d
+}
+
+// Bitfield32Bytes gets the native-endian 8-byte representation of a Bitfield32.
+func Bitfield32Bytes(bf Bitfield32) []byte {
+	d := make([]byte, 8)
+	nlenc.PutUint32(d[0:4], bf.Value)
+	nlenc.PutUint32(d[4:8], bf.Selector)
+	return d
+}
+
+// hasChildren returns true if the Attribute's payload consists of nested
+// attributes, whether or not its Nested flag is set.
+func (a Attribute) hasChildren() bool {
+	return a.Nested || a.Children != nil
 }
 
 // encode returns a function that takes an AttributeEncoder and returns error.
@@ -196,7 +400,7 @@ func (a *Attribute) encode(attrs []Attribute) func(*netlink.AttributeEncoder) er
 	return func(ae *netlink.AttributeEncoder) error {
 		for _, nfa := range attrs {
 			if nfa.NetByteOrder && nfa.Nested {
-				return errInvalidAttributeFlags
+				return ErrInvalidAttributeFlags
 			}
 
 			if nfa.Nested {
@@ -208,6 +412,15 @@ func (a *Attribute) encode(attrs []Attribute) func(*netlink.AttributeEncoder) er
 			if nfa.NetByteOrder {
 				nfa.Type |= netlink.NetByteOrder
 			}
+
+			// Nested payload without the Nested flag, see NestingSchema.
+			if nfa.Children != nil {
+				ae.Do(nfa.Type, func() ([]byte, error) {
+					return MarshalAttributes(nfa.Children)
+				})
+				continue
+			}
+
 			ae.Bytes(nfa.Type, nfa.Data)
 		}
 
@@ -215,31 +428,60 @@ func (a *Attribute) encode(attrs []Attribute) func(*netlink.AttributeEncoder) er
 	}
 }
 
-// decodeAttributes returns an array of netfilter.Attributes decoded from
-// a byte array. This byte array should be taken from the netlink.Message's
-// Data payload after the nfHeaderLen offset.
-func decodeAttributes(ad *netlink.AttributeDecoder) ([]Attribute, error) {
-	// Use the Children element of the Attribute to decode into.
-	// Attribute already has nested decoding implemented on the type.
-	var a Attribute
+// decodeAttributes decodes the attributes in b into a list of Attributes,
+// recursing into nested attributes and attribute types listed in schema. The
+// offset of b within the caller's buffer and the path of attribute types
+// enclosing b are used for reporting a *DecodeError.
+func decodeAttributes(b []byte, off int, path []uint16, schema NestingSchema) ([]Attribute, error) {
+	var attrs []Attribute
+
+	it := NewAttributeIterator(b)
+	for it.Next() {
+		v := it.View()
+
+		// Copy the attribute's payload so the result doesn't alias b.
+		a := Attribute{
+			Type:         v.Type(),
+			Data:         bytes.Clone(v.Data()),
+			Nested:       v.Nested(),
+			NetByteOrder: v.NetByteOrder(),
+		}
+
+		// Decode children if the Nested flag is set, or if the schema marks the
+		// payload as nested while the kernel omitted the flag. In the latter case,
+		// leave Nested unset so the attribute is re-encoded exactly as received.
+		children, hinted := schema[a.Type]
+		if a.Nested || hinted {
+			var err error
+			a.Children, err = decodeAttributes(v.Data(), off+it.Offset()+nlaHeaderLen, appendPath(path, a.Type), children)
+			if err != nil {
+				return nil, err
+			}
+
+			if hinted && a.Children == nil {
+				a.Children = []Attribute{}
+			}
+		}
 
-	// Pre-allocate backing array when there are netlink attributes to decode.
-	if ad.Len() != 0 {
-		a.Children = make([]Attribute, 0, ad.Len())
+		attrs = append(attrs, a)
 	}
 
-	// Catch any errors encountered parsing netfilter structures.
-	if err := a.decode(ad); err != nil {
-		return nil, err
+	if err := it.Err(); err != nil {
+		// The current view holds the offending attribute if its header could
+		// be parsed, which is the case for invalid flags.
+		if errors.Is(err, ErrInvalidAttributeFlags) {
+			path = appendPath(path, it.View().Type())
+		}
+		return nil, &DecodeError{Offset: off + it.Offset(), Path: path, Err: err}
 	}
 
-	return a.Children, nil
+	return attrs, nil
 }
 
 // encodeAttributes encodes a list of Attributes into the given netlink.AttributeEncoder.
 func encodeAttributes(ae *netlink.AttributeEncoder, attrs []Attribute) error {
 	if ae == nil {
-		return errNilAttributeEncoder
+		return ErrNilAttributeEncoder
 	}
 
 	attr := Attribute{}
@@ -250,25 +492,99 @@ func encodeAttributes(ae *netlink.AttributeEncoder, attrs []Attribute) error {
 // This byte slice can then be copied into a netlink.Message's Data field after
 // the nfHeaderLen offset.
 func MarshalAttributes(attrs []Attribute) ([]byte, error) {
-	ae := NewAttributeEncoder()
-	if err := encodeAttributes(ae, attrs); err != nil {
-		return nil, err
+	return appendAttributes(make([]byte, 0, attributesLen(attrs)), attrs)
+}
+
+// UnmarshalAttributes unmarshals a byte slice into a list of Attributes.
+// Malformed input results in a *DecodeError, with offsets relative to b.
+func UnmarshalAttributes(b []byte) ([]Attribute, error) {
+	return decodeAttributes(b, 0, nil, nil)
+}
+
+// UnmarshalAttributesWithSchema unmarshals a byte slice into a list of
+// Attributes, decoding the attribute types listed in schema as nested
+// attributes even if their Nested flag is not set. See NestingSchema.
+func UnmarshalAttributesWithSchema(b []byte, schema NestingSchema) ([]Attribute, error) {
+	return decodeAttributes(b, 0, nil, schema)
+}
+
+// EncodedLen returns the amount of bytes the Attribute occupies when encoded
+// using MarshalAttributes or AppendAttributes, including its header, any nested
+// children and alignment padding.
+func (a Attribute) EncodedLen() int {
+	if a.hasChildren() {
+		return nlaHeaderLen + attributesLen(a.Children)
+	}
+
+	return nlaHeaderLen + nlaAlign(len(a.Data))
+}
+
+// attributesLen returns the total encoded length of attrs.
+func attributesLen(attrs []Attribute) int {
+	var l int
+	for _, a := range attrs {
+		l += a.EncodedLen()
 	}
+	return l
+}
 
-	b, err := ae.Encode()
+// AppendAttributes appends the wire representation of attrs to dst and
+// returns the extended buffer. It produces the same output as MarshalAttributes,
+// but allows the caller to reuse buffers. Use EncodedLen to pre-size dst.
+// On error, dst is returned at its original length.
+func AppendAttributes(dst []byte, attrs []Attribute) ([]byte, error) {
+	out, err := appendAttributes(dst, attrs)
 	if err != nil {
-		return nil, err
+		return dst, err
 	}
 
-	return b, nil
+	return out, nil
 }
 
-// UnmarshalAttributes unmarshals a byte slice into a list of Attributes.
-func UnmarshalAttributes(b []byte) ([]Attribute, error) {
-	ad, err := NewAttributeDecoder(b)
-	if err != nil {
-		return nil, err
+// appendAttributes implements AppendAttributes, returning nil on error.
+func appendAttributes(dst []byte, attrs []Attribute) ([]byte, error) {
+	dst = slices.Grow(dst, attributesLen(attrs))
+
+	for _, a := range attrs {
+		if a.NetByteOrder && a.Nested {
+			return nil, ErrInvalidAttributeFlags
+		}
+
+		// Reserve the attribute header, its length is known after the payload is written.
+		start := len(dst)
+		dst = append(dst, 0, 0, 0, 0)
+
+		t := a.Type
+		if a.NetByteOrder {
+			t |= netlink.NetByteOrder
+		}
+
+		if a.hasChildren() {
+			if a.Nested {
+				t |= netlink.Nested
+			}
+
+			var err error
+			if dst, err = appendAttributes(dst, a.Children); err != nil {
+				return nil, err
+			}
+		} else {
+			dst = append(dst, a.Data...)
+		}
+
+		l := len(dst) - start
+		if l > math.MaxUint16 {
+			return nil, ErrAttributeTooLarge
+		}
+
+		nlenc.PutUint16(dst[start:start+2], uint16(l))
+		nlenc.PutUint16(dst[start+2:start+4], t)
+
+		// Pad the attribute to the netlink alignment boundary.
+		for i := l; i < nlaAlign(l); i++ {
+			dst = append(dst, 0)
+		}
 	}
 
-	return decodeAttributes(ad)
+	return dst, nil
 }
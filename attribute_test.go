@@ -1,11 +1,17 @@
 package netfilter
 
 import (
+	"math"
+	"net"
+	"net/netip"
 	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/mdlayher/netlink"
+	"github.com/mdlayher/netlink/nlenc"
 )
 
 func TestAttributeScalarPanicEmpty(t *testing.T) {
@@ -161,7 +167,7 @@ func TestAttributeMarshalErrors(t *testing.T) {
 					NetByteOrder: true,
 				},
 			},
-			err: errInvalidAttributeFlags,
+			err: ErrInvalidAttributeFlags,
 		},
 		{
 			name: "error in nested attribute",
@@ -179,7 +185,7 @@ func TestAttributeMarshalErrors(t *testing.T) {
 					},
 				},
 			},
-			err: errInvalidAttributeFlags,
+			err: ErrInvalidAttributeFlags,
 		},
 	}
 
@@ -370,13 +376,8 @@ func TestAttributeMarshalTwoWay(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 
-			ad, err := NewAttributeDecoder(tt.b)
-			if err != nil {
-				t.Fatal("unexpected error creating AttributeDecoder:", err)
-			}
-
 			// Unmarshal binary content into nested structures
-			attrs, err := decodeAttributes(ad)
+			attrs, err := UnmarshalAttributes(tt.b)
 			require.NoError(t, err)
 			assert.Equal(t, tt.attrs, attrs, "unexpected decode")
 
@@ -390,5 +391,267 @@ func TestAttributeMarshalTwoWay(t *testing.T) {
 }
 
 func TestErrors(t *testing.T) {
-	assert.EqualError(t, encodeAttributes(nil, nil), errNilAttributeEncoder.Error())
+	assert.EqualError(t, encodeAttributes(nil, nil), ErrNilAttributeEncoder.Error())
+}
+
+func TestAttributeParseScalar(t *testing.T) {
+	attr := Attribute{Type: 3, Data: []byte{0xab, 0xcd}}
+
+	u16, err := attr.ParseUint16()
+	require.NoError(t, err)
+	assert.Equal(t, uint16(0xabcd), u16)
+
+	_, err = attr.ParseUint32()
+	var ae *AttributeError
+	require.ErrorAs(t, err, &ae)
+	assert.ErrorIs(t, err, ErrAttributeLength)
+	assert.Equal(t, &AttributeError{Op: "Uint32", Type: 3, Length: 2, Err: ErrAttributeLength}, ae)
+	assert.EqualError(t, err, "Uint32: attribute type 3, length 2: unexpected attribute length")
+
+	_, err = attr.ParseUint64()
+	assert.ErrorIs(t, err, ErrAttributeLength)
+
+	attr = Attribute{Data: []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}}
+	i64, err := attr.ParseInt64()
+	require.NoError(t, err)
+	assert.Equal(t, int64(-1), i64)
+
+	attr.Data = attr.Data[:4]
+	i32, err := attr.ParseInt32()
+	require.NoError(t, err)
+	assert.Equal(t, int32(-1), i32)
+
+	nested := Attribute{Type: 1, Nested: true}
+	for _, fn := range []func() error{
+		func() error { _, err := nested.ParseUint16(); return err },
+		func() error { _, err := nested.ParseUint32(); return err },
+		func() error { _, err := nested.ParseUint64(); return err },
+		func() error { _, err := nested.ParseInt32(); return err },
+		func() error { _, err := nested.ParseInt64(); return err },
+	} {
+		assert.ErrorIs(t, fn(), ErrAttributeNested)
+	}
+}
+
+func TestAttributeDecodeScalar(t *testing.T) {
+	b, err := MarshalAttributes([]Attribute{
+		{Type: 1, Data: Uint16Bytes(0x1234)},
+		{Type: 2, Data: Uint32Bytes(0xffffffff)},
+		{Type: 3, Data: Uint64Bytes(0xffffffffffffffff)},
+		{Type: 4, Nested: true, Children: []Attribute{{Type: 1, Data: Uint16Bytes(1)}}},
+	})
+	require.NoError(t, err)
+
+	ad, err := NewAttributeDecoder(b)
+	require.NoError(t, err)
+
+	for ad.Next() {
+		switch ad.Type() {
+		case 1:
+			v, err := DecodeUint16(ad)
+			require.NoError(t, err)
+			assert.Equal(t, uint16(0x1234), v)
+
+			_, err = DecodeUint32(ad)
+			assert.ErrorIs(t, err, ErrAttributeLength)
+		case 2:
+			v, err := DecodeInt32(ad)
+			require.NoError(t, err)
+			assert.Equal(t, int32(-1), v)
+		case 3:
+			v, err := DecodeInt64(ad)
+			require.NoError(t, err)
+			assert.Equal(t, int64(-1), v)
+
+			u, err := DecodeUint64(ad)
+			require.NoError(t, err)
+			assert.Equal(t, uint64(0xffffffffffffffff), u)
+		case 4:
+			_, err := DecodeUint16(ad)
+			var ae *AttributeError
+			require.ErrorAs(t, err, &ae)
+			assert.Equal(t, uint16(4), ae.Type)
+			assert.ErrorIs(t, err, ErrAttributeNested)
+		}
+	}
+
+	// Accessor errors must not poison the decoder.
+	require.NoError(t, ad.Err())
+}
+
+func TestAttributeAppend(t *testing.T) {
+	attrs := []Attribute{
+		{Type: 1, Data: []byte{1, 2, 3}},
+		{Type: 2, Nested: true, Children: []Attribute{
+			{Type: 1, Data: []byte{1}, NetByteOrder: true},
+			{Type: 2, Nested: true, Children: []Attribute{
+				{Type: 3, Data: []byte{1, 2, 3, 4, 5}},
+			}},
+			{Type: 4, Nested: true},
+		}},
+		{Type: 3, Data: []byte{}},
+	}
+
+	// Compare against the netlink package's attribute encoder.
+	ae := NewAttributeEncoder()
+	require.NoError(t, encodeAttributes(ae, attrs))
+	want, err := ae.Encode()
+	require.NoError(t, err)
+
+	l := 0
+	for _, a := range attrs {
+		l += a.EncodedLen()
+	}
+	assert.Equal(t, len(want), l)
+
+	// Append to a buffer with a prefix and stale data beyond its length.
+	buf := make([]byte, 2, 128)
+	for i := range buf[:cap(buf)] {
+		buf[:cap(buf)][i] = 0xff
+	}
+
+	b, err := AppendAttributes(buf, attrs)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0xff, 0xff}, b[:2])
+	assert.Equal(t, want, b[2:])
+
+	got, err := MarshalAttributes(attrs)
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+
+	_, err = AppendAttributes(nil, []Attribute{{Nested: true, Children: []Attribute{{Nested: true, NetByteOrder: true}}}})
+	assert.ErrorIs(t, err, ErrInvalidAttributeFlags)
+
+	_, err = AppendAttributes(nil, []Attribute{{Data: make([]byte, math.MaxUint16)}})
+	assert.ErrorIs(t, err, ErrAttributeTooLarge)
+
+	// The caller's buffer survives an encoding error.
+	b, err = AppendAttributes(buf, []Attribute{{Type: 1, Data: []byte{1}}, {Nested: true, NetByteOrder: true}})
+	assert.ErrorIs(t, err, ErrInvalidAttributeFlags)
+	assert.Equal(t, []byte{0xff, 0xff}, b)
+	assert.Equal(t, cap(buf), cap(b))
+}
+
+func TestAttributeAddr(t *testing.T) {
+	var attr Attribute
+
+	for _, s := range []string{"192.0.2.1", "2001:db8::1", "::ffff:192.0.2.1"} {
+		addr := netip.MustParseAddr(s)
+
+		attr.PutAddr(addr)
+		assert.Equal(t, AddrBytes(addr), attr.Data)
+
+		got, err := attr.ParseAddr()
+		require.NoError(t, err)
+		assert.Equal(t, addr, got)
+	}
+
+	attr.PutAddr(netip.MustParseAddr("192.0.2.1"))
+	assert.Len(t, attr.Data, 4)
+
+	_, err := Attribute{Data: []byte{1, 2, 3}}.ParseAddr()
+	assert.ErrorIs(t, err, ErrAttributeLength)
+
+	_, err = Attribute{Nested: true}.ParseAddr()
+	assert.ErrorIs(t, err, ErrAttributeNested)
+
+	assert.Nil(t, AddrBytes(netip.Addr{}))
+}
+
+func TestAttributeParseString(t *testing.T) {
+	var attr Attribute
+
+	attr.PutString("ftp")
+	assert.Equal(t, []byte("ftp\x00"), attr.Data)
+	assert.Equal(t, []byte("ftp\x00"), StringBytes("ftp"))
+
+	s, err := attr.ParseString()
+	require.NoError(t, err)
+	assert.Equal(t, "ftp", s)
+
+	// Strings without NUL terminator and with trailing garbage.
+	for data, want := range map[string]string{
+		"ftp":         "ftp",
+		"ftp\x00\x00": "ftp",
+		"ftp\x00abc":  "ftp",
+		"":            "",
+	} {
+		s, err := Attribute{Data: []byte(data)}.ParseString()
+		require.NoError(t, err)
+		assert.Equal(t, want, s)
+	}
+
+	_, err = Attribute{Nested: true}.ParseString()
+	assert.ErrorIs(t, err, ErrAttributeNested)
+}
+
+func TestAttributeHardwareAddr(t *testing.T) {
+	hw, err := net.ParseMAC("00:00:5e:00:53:01")
+	require.NoError(t, err)
+
+	var attr Attribute
+	attr.PutHardwareAddr(hw)
+	assert.Equal(t, []byte(hw), attr.Data)
+
+	got, err := attr.ParseHardwareAddr()
+	require.NoError(t, err)
+	assert.Equal(t, hw, got)
+
+	// The result must not alias the attribute.
+	got[0] = 0xff
+	assert.Equal(t, byte(0), attr.Data[0])
+
+	_, err = Attribute{}.ParseHardwareAddr()
+	assert.ErrorIs(t, err, ErrAttributeLength)
+
+	_, err = Attribute{Nested: true}.ParseHardwareAddr()
+	assert.ErrorIs(t, err, ErrAttributeNested)
+}
+
+func TestAttributeBitfield32(t *testing.T) {
+	bf := Bitfield32{Value: 0x1, Selector: 0x3}
+
+	var attr Attribute
+	attr.PutBitfield32(bf)
+	assert.Equal(t, Bitfield32Bytes(bf), attr.Data)
+	assert.Equal(t, append(nlenc.Uint32Bytes(1), nlenc.Uint32Bytes(3)...), attr.Data)
+
+	got, err := attr.ParseBitfield32()
+	require.NoError(t, err)
+	assert.Equal(t, bf, got)
+
+	_, err = Attribute{Data: []byte{1}}.ParseBitfield32()
+	assert.ErrorIs(t, err, ErrAttributeLength)
+}
+
+func TestUnmarshalAttributesDecodeError(t *testing.T) {
+	b, err := MarshalAttributes([]Attribute{
+		{Type: 1, Data: []byte{1}},
+		{Type: 2, Nested: true, Children: []Attribute{
+			{Type: 1, Data: []byte{1, 2, 3, 4}},
+			{Type: 3, Nested: true, Children: []Attribute{
+				{Type: 1},
+			}},
+		}},
+	})
+	require.NoError(t, err)
+
+	// Set both flags on the innermost attribute.
+	nlenc.PutUint16(b[len(b)-2:], 1|netlink.Nested|netlink.NetByteOrder)
+
+	_, err = UnmarshalAttributes(b)
+
+	var de *DecodeError
+	require.ErrorAs(t, err, &de)
+	assert.Equal(t, len(b)-4, de.Offset)
+	assert.Equal(t, []uint16{2, 3, 1}, de.Path)
+	assert.ErrorIs(t, err, ErrInvalidAttributeFlags)
+	assert.EqualError(t, err,
+		"decoding netfilter message at offset 24, attribute 2/3/1: "+ErrInvalidAttributeFlags.Error())
+
+	_, err = UnmarshalAttributes([]byte{1})
+	require.ErrorAs(t, err, &de)
+	assert.Equal(t, 0, de.Offset)
+	assert.Nil(t, de.Path)
+	assert.EqualError(t, err, "decoding netfilter message at offset 0: "+ErrInvalidAttributeLength.Error())
 }
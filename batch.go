@@ -0,0 +1,206 @@
+package netfilter
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mdlayher/netlink"
+)
+
+// A Batch collects messages to be sent to a single subsystem as one nfnetlink
+// transaction, framed by NFNLMsgBatchBegin and NFNLMsgBatchEnd messages. The
+// kernel either applies all of a batch's messages or none of them. Batches are
+// supported by subsystems like nf_tables, but not by conntrack.
+type Batch struct {
+	subsys SubsystemID
+	msgs   []Message
+}
+
+// NewBatch returns an empty Batch for subsystem subsys.
+func NewBatch(subsys SubsystemID) *Batch {
+	return &Batch{subsys: subsys}
+}
+
+// Add appends a message to the Batch and returns its index, which identifies
+// the message's BatchResult. The Request and Acknowledge flags are set on the
+// message, so the kernel reports a result for each message.
+func (b *Batch) Add(h Header, attrs []Attribute) int {
+	h.Flags |= netlink.Request | netlink.Acknowledge
+	b.msgs = append(b.msgs, Message{Header: h, Attributes: attrs})
+	return len(b.msgs) - 1
+}
+
+// Len returns the amount of messages in the Batch.
+func (b *Batch) Len() int {
+	return len(b.msgs)
+}
+
+// A BatchResult describes the outcome of a single message in a Batch.
+type BatchResult struct {
+	// Header of the message, as added to the Batch.
+	Header Header
+
+	// Sequence number the message was sent with.
+	Sequence uint32
+
+	// Messages sent by the kernel in reply to the message, eg. when the
+	// request has the netlink.Echo flag set.
+	Replies []netlink.Message
+
+	// The *OpError reported by the kernel for the message, if any.
+	Err error
+}
+
+// A BatchError is returned by SendBatch when the kernel rejected one or more
+// messages in a Batch, aborting the whole transaction.
+type BatchError struct {
+	// Index of the first message in the Batch that was rejected.
+	Index int
+
+	// The error reported for the message, an *OpError.
+	Err error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("batch message %d: %v", e.Index, e.Err)
+}
+
+// Unwrap returns the underlying error, for use with errors.Is and errors.As.
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// batchHeader returns the Header of a message framing a batch for subsys.
+func batchHeader(mt MessageType, subsys SubsystemID) Header {
+	return Header{
+		Flags:       netlink.Request,
+		SubsystemID: NFSubsysNone,
+		MessageType: mt,
+		ResourceID:  uint16(subsys),
+	}
+}
+
+// SendBatch sends all messages in b to the kernel in a single write and waits
+// for their results, see SendBatchContext.
+func (c *Conn) SendBatch(b *Batch) ([]BatchResult, error) {
+	return c.SendBatchContext(context.Background(), b)
+}
+
+// SendBatchContext sends all messages in b to the kernel in a single write and
+// waits for their results. It returns one BatchResult per message, in the order
+// they were added to b.
+//
+// If the kernel rejected any message, the transaction is aborted and a
+// *BatchError identifying the first rejected message is returned along with
+// the results. If the kernel rejected the batch as a whole, for example because
+// the subsystem doesn't support batches, an *OpError is returned instead.
+//
+// Cancelling ctx stops waiting for the results and returns an *OpError wrapping
+// ctx.Err(). The kernel may still apply the batch in that case. Like
+// QueryContext, cancellation clears any deadline set using SetReadDeadline.
+func (c *Conn) SendBatchContext(ctx context.Context, b *Batch) ([]BatchResult, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if err := c.checkUsable(); err != nil {
+		return nil, err
+	}
+
+	c.reqMu.Lock()
+	defer c.reqMu.Unlock()
+	c.waitReader()
+
+	if err := ctx.Err(); err != nil {
+		return nil, &OpError{Op: "batch", Header: batchHeader(NFNLMsgBatchBegin, b.subsys), Err: err}
+	}
+
+	// Marshal the batch, framed by its begin and end messages.
+	begin, err := MarshalNetlink(batchHeader(NFNLMsgBatchBegin, b.subsys), nil)
+	if err != nil {
+		return nil, err
+	}
+	end, err := MarshalNetlink(batchHeader(NFNLMsgBatchEnd, b.subsys), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req := make([]netlink.Message, 0, len(b.msgs)+2)
+	req = append(req, begin)
+	for _, m := range b.msgs {
+		nlm, err := m.MarshalNetlink()
+		if err != nil {
+			return nil, err
+		}
+		req = append(req, nlm)
+	}
+	req = append(req, end)
+
+	trace(c.debug, "send", req...)
+
+	req, err = c.conn.SendMessages(req)
+	if err != nil {
+		return nil, &OpError{Op: "batch", Header: batchHeader(NFNLMsgBatchBegin, b.subsys), Err: err}
+	}
+
+	// Map sequence numbers to the index of their message within the batch.
+	results := make([]BatchResult, len(b.msgs))
+	index := make(map[uint32]int, len(b.msgs))
+	for i, m := range b.msgs {
+		seq := req[i+1].Header.Sequence
+		results[i] = BatchResult{Header: m.Header, Sequence: seq}
+		index[seq] = i
+	}
+	beginSeq := req[0].Header.Sequence
+	acked := make([]bool, len(b.msgs))
+
+	for pending := len(results); pending > 0; {
+		var msgs []netlink.Message
+		err := c.withContext(ctx, func() (err error) {
+			msgs, err = c.receiveRaw()
+			return err
+		})
+		if err != nil {
+			return nil, &OpError{Op: "batch", Header: batchHeader(NFNLMsgBatchBegin, b.subsys), Err: err}
+		}
+
+		trace(c.debug, "recv", msgs...)
+
+		for _, m := range msgs {
+			// The kernel rejected the batch as a whole.
+			if m.Header.Sequence == beginSeq {
+				if err := ackError(m); err != nil {
+					return nil, requestError("batch", req[0], err)
+				}
+				continue
+			}
+
+			i, ok := index[m.Header.Sequence]
+			if !ok {
+				continue
+			}
+
+			if m.Header.Type != netlink.Error {
+				results[i].Replies = append(results[i].Replies, m)
+				continue
+			}
+
+			if acked[i] {
+				continue
+			}
+			acked[i] = true
+			pending--
+
+			if err := ackError(m); err != nil {
+				results[i].Err = requestError("batch", req[i+1], err)
+			}
+		}
+	}
+
+	for i, r := range results {
+		if r.Err != nil {
+			return results, &BatchError{Index: i, Err: r.Err}
+		}
+	}
+
+	return results, nil
+}
@@ -0,0 +1,172 @@
+package netfilter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mdlayher/netlink"
+	"golang.org/x/sys/unix"
+)
+
+func TestConnSendBatch(t *testing.T) {
+	var sent []netlink.Message
+	c := rawTestConn(func(req []netlink.Message) []netlink.Message {
+		sent = req
+
+		// Reply to the second message and reject the third.
+		echo := req[2]
+		echo.Header.Type = 0x0a01
+		return []netlink.Message{
+			errorMessage(req[1], 0, "", 0),
+			echo,
+			errorMessage(req[2], 0, "", 0),
+			errorMessage(req[3], unix.EEXIST, "exists", nlmsgHeaderLen+nfHeaderLen),
+		}
+	})
+
+	b := NewBatch(NFSubsysNFTables)
+	for i := range 3 {
+		assert.Equal(t, i, b.Add(Header{SubsystemID: NFSubsysNFTables, MessageType: MessageType(i)},
+			[]Attribute{{Type: 1, Data: []byte{uint8(i)}}}))
+	}
+	assert.Equal(t, 3, b.Len())
+
+	results, err := c.SendBatch(b)
+
+	// Check the framing of the batch.
+	require.Len(t, sent, 5)
+	for i, mt := range map[int]MessageType{0: NFNLMsgBatchBegin, 4: NFNLMsgBatchEnd} {
+		h, _, err := UnmarshalNetlink(sent[i])
+		require.NoError(t, err)
+		assert.Equal(t, NFSubsysNone, h.SubsystemID)
+		assert.Equal(t, mt, h.MessageType)
+		assert.Equal(t, uint16(NFSubsysNFTables), h.ResourceID)
+	}
+	h, _, err2 := UnmarshalNetlink(sent[1])
+	require.NoError(t, err2)
+	assert.Equal(t, netlink.Request|netlink.Acknowledge, h.Flags)
+
+	var be *BatchError
+	require.ErrorAs(t, err, &be)
+	assert.Equal(t, 2, be.Index)
+	assert.ErrorIs(t, err, unix.EEXIST)
+
+	var oe *OpError
+	require.ErrorAs(t, err, &oe)
+	assert.Equal(t, "exists", oe.Message)
+	assert.Equal(t, []uint16{1}, oe.Path)
+	assert.Equal(t, MessageType(2), oe.Header.MessageType)
+
+	require.Len(t, results, 3)
+	for i, r := range results {
+		assert.Equal(t, sent[i+1].Header.Sequence, r.Sequence)
+		assert.Equal(t, MessageType(i), r.Header.MessageType)
+	}
+	assert.NoError(t, results[0].Err)
+	assert.Len(t, results[1].Replies, 1)
+	assert.ErrorIs(t, results[2].Err, unix.EEXIST)
+}
+
+func TestConnSendBatchRejected(t *testing.T) {
+	c := rawTestConn(func(req []netlink.Message) []netlink.Message {
+		return []netlink.Message{errorMessage(req[0], unix.EOPNOTSUPP, "", 0)}
+	})
+
+	b := NewBatch(NFSubsysCTNetlink)
+	b.Add(Header{SubsystemID: NFSubsysCTNetlink}, nil)
+
+	results, err := c.SendBatch(b)
+	assert.Nil(t, results)
+	assert.ErrorIs(t, err, unix.EOPNOTSUPP)
+
+	var oe *OpError
+	require.ErrorAs(t, err, &oe)
+	assert.Equal(t, NFNLMsgBatchBegin, oe.Header.MessageType)
+}
+
+func TestConnSendBatchSuccess(t *testing.T) {
+	c := rawTestConn(func(req []netlink.Message) []netlink.Message {
+		var acks []netlink.Message
+		for _, m := range req[1 : len(req)-1] {
+			acks = append(acks, errorMessage(m, 0, "", 0))
+		}
+		return acks
+	})
+
+	b := NewBatch(NFSubsysNFTables)
+	b.Add(Header{SubsystemID: NFSubsysNFTables}, nil)
+	b.Add(Header{SubsystemID: NFSubsysNFTables}, nil)
+
+	results, err := c.SendBatch(b)
+	require.NoError(t, err)
+	assert.Len(t, results, 2)
+
+	// Receive errors are reported as an OpError.
+	c.recvRaw = func() ([]netlink.Message, error) { return nil, unix.ENOBUFS }
+	_, err = c.SendBatch(b)
+	assert.ErrorIs(t, err, unix.ENOBUFS)
+
+	_, err = (&Conn{isMulticast: true}).SendBatch(b)
+	assert.ErrorIs(t, err, ErrConnIsMulticast)
+}
+
+func TestConnSendBatchContext(t *testing.T) {
+	c, err := Dial(nil)
+	require.NoError(t, err)
+	defer c.Close()
+
+	// Discard everything read from the socket, so the batch never completes
+	// until the read is interrupted.
+	raw := &Conn{conn: c.conn}
+	c.recvRaw = func() ([]netlink.Message, error) {
+		for {
+			if _, err := raw.receiveRaw(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	b := NewBatch(NFSubsysNFTables)
+	b.Add(Header{SubsystemID: NFSubsysNFTables, MessageType: 16}, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err = c.SendBatchContext(ctx, b)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	var oe *OpError
+	require.ErrorAs(t, err, &oe)
+	assert.Equal(t, "batch", oe.Op)
+
+	// Done contexts fail before sending.
+	_, err = c.SendBatchContext(ctx, b)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestConnSendBatchSocket(t *testing.T) {
+	c, err := Dial(nil)
+	require.NoError(t, err)
+	defer c.Close()
+
+	require.NoError(t, c.SetReadDeadline(time.Now().Add(5*time.Second)))
+
+	// Exercise reading results from a real socket. NFT_MSG_GETGEN is not a
+	// valid batch operation, and the batch is rejected as a whole without
+	// CAP_NET_ADMIN or if nf_tables is unavailable, so an error is expected.
+	b := NewBatch(NFSubsysNFTables)
+	b.Add(Header{SubsystemID: NFSubsysNFTables, MessageType: 16}, nil)
+
+	_, err = c.SendBatch(b)
+
+	var oe *OpError
+	require.ErrorAs(t, err, &oe)
+	assert.Equal(t, "batch", oe.Op)
+
+	var errno unix.Errno
+	assert.ErrorAs(t, err, &errno)
+}
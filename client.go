@@ -0,0 +1,144 @@
+package netfilter
+
+import (
+	"context"
+	"errors"
+	"io"
+	"iter"
+	"time"
+
+	"github.com/mdlayher/netlink"
+)
+
+// A Client sends requests to and receives events from the Netfilter subsystem.
+// A Conn attached to multicast groups can't be used for requests, so a Client
+// owns two of them: one for requests and one for events. Settings like buffer
+// sizes are applied to both. Read deadlines only apply to the event Conn, since
+// the request Conn manages its own read deadline to implement cancellation. Use
+// QueryContext and DumpContext to bound the time spent waiting for responses.
+type Client struct {
+	query  *Conn
+	events *Conn
+}
+
+// DialClient opens the Conns for a new Client, both using config.
+func DialClient(config *netlink.Config) (*Client, error) {
+	query, err := Dial(config)
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := Dial(config)
+	if err != nil {
+		query.Close()
+		return nil, err
+	}
+
+	return &Client{query: query, events: events}, nil
+}
+
+// Close closes both of the Client's Conns, ending any active subscription.
+func (c *Client) Close() error {
+	return errors.Join(c.query.Close(), c.events.Close())
+}
+
+// Query sends a request on the Client's request Conn, see Conn.Query.
+func (c *Client) Query(nlm netlink.Message) ([]netlink.Message, error) {
+	return c.query.Query(nlm)
+}
+
+// QueryContext sends a request on the Client's request Conn, see
+// Conn.QueryContext.
+func (c *Client) QueryContext(ctx context.Context, nlm netlink.Message) ([]netlink.Message, error) {
+	return c.query.QueryContext(ctx, nlm)
+}
+
+// Dump sends a dump request on the Client's request Conn, see Conn.Dump.
+func (c *Client) Dump(nlm netlink.Message) iter.Seq2[Message, error] {
+	return c.query.Dump(nlm)
+}
+
+// DumpContext sends a dump request on the Client's request Conn, see
+// Conn.DumpContext.
+func (c *Client) DumpContext(ctx context.Context, nlm netlink.Message) iter.Seq2[Message, error] {
+	return c.query.DumpContext(ctx, nlm)
+}
+
+// SendBatch sends a Batch on the Client's request Conn, see Conn.SendBatch.
+func (c *Client) SendBatch(b *Batch) ([]BatchResult, error) {
+	return c.query.SendBatch(b)
+}
+
+// SendBatchContext sends a Batch on the Client's request Conn, see
+// Conn.SendBatchContext.
+func (c *Client) SendBatchContext(ctx context.Context, b *Batch) ([]BatchResult, error) {
+	return c.query.SendBatchContext(ctx, b)
+}
+
+// Subscribe receives events for groups on the Client's event Conn, see
+// Conn.Subscribe. Requests can be sent while the subscription is active.
+func (c *Client) Subscribe(ctx context.Context, groups []NetlinkGroup) (<-chan Message, <-chan error, error) {
+	return c.events.Subscribe(ctx, groups)
+}
+
+// Groups returns the multicast groups the Client's event Conn is attached to.
+func (c *Client) Groups() []NetlinkGroup {
+	return c.events.Groups()
+}
+
+// SetDebug makes both of the Client's Conns write a rendering of the messages
+// they send and receive to w, see Conn.SetDebug.
+func (c *Client) SetDebug(w io.Writer) {
+	c.query.SetDebug(w)
+	c.events.SetDebug(w)
+}
+
+// SetDumpRetries sets the amount of times Query restarts interrupted dumps,
+// see Conn.SetDumpRetries.
+func (c *Client) SetDumpRetries(n int) {
+	c.query.SetDumpRetries(n)
+}
+
+// SetOption enables or disables a netlink socket option for both of the
+// Client's Conns.
+func (c *Client) SetOption(option netlink.ConnOption, enable bool) error {
+	return c.both(func(conn *Conn) error { return conn.SetOption(option, enable) })
+}
+
+// SetDeadline sets the read and write deadlines of the Client's event Conn, and
+// the write deadline of its request Conn. An active subscription ends with an
+// error when its read deadline passes.
+func (c *Client) SetDeadline(t time.Time) error {
+	return errors.Join(c.query.SetWriteDeadline(t), c.events.SetDeadline(t))
+}
+
+// SetReadDeadline sets the read deadline of the Client's event Conn. An active
+// subscription ends with an error when its read deadline passes. It has no
+// effect on requests, use QueryContext or DumpContext instead.
+func (c *Client) SetReadDeadline(t time.Time) error {
+	return c.events.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the write deadline of both of the Client's Conns.
+func (c *Client) SetWriteDeadline(t time.Time) error {
+	return c.both(func(conn *Conn) error { return conn.SetWriteDeadline(t) })
+}
+
+// SetReadBuffer sets the size of the operating system's receive buffer of both
+// of the Client's Conns. Larger buffers make overruns of the event Conn less
+// likely.
+func (c *Client) SetReadBuffer(bytes int) error {
+	return c.both(func(conn *Conn) error { return conn.SetReadBuffer(bytes) })
+}
+
+// SetWriteBuffer sets the size of the operating system's transmit buffer of
+// both of the Client's Conns.
+func (c *Client) SetWriteBuffer(bytes int) error {
+	return c.both(func(conn *Conn) error { return conn.SetWriteBuffer(bytes) })
+}
+
+// both calls fn for the Client's request and event Conns, returning the
+// errors of both calls.
+func (c *Client) both(fn func(*Conn) error) error {
+	return errors.Join(fn(c.query), fn(c.events))
+}
@@ -0,0 +1,125 @@
+package netfilter
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mdlayher/netlink"
+)
+
+func TestDialClient(t *testing.T) {
+	c, err := DialClient(nil)
+	require.NoError(t, err, "opening Client")
+
+	require.NoError(t, c.SetDeadline(time.Now().Add(time.Second)), "setting global deadline")
+	require.NoError(t, c.SetReadDeadline(time.Now().Add(time.Second)), "setting read deadline")
+	require.NoError(t, c.SetWriteDeadline(time.Now().Add(time.Second)), "setting write deadline")
+	require.NoError(t, c.SetReadBuffer(256), "setting read buffer")
+	require.NoError(t, c.SetWriteBuffer(256), "setting write buffer")
+	require.NoError(t, c.SetOption(netlink.ExtendedAcknowledge, true), "setting option")
+
+	require.NoError(t, c.Close(), "closing Client")
+
+	_, err = DialClient(&netlink.Config{NetNS: 1337})
+	assert.Error(t, err)
+}
+
+func TestClient(t *testing.T) {
+	query, _ := dumpTestConn(t, 3, 2, 0)
+	c := Client{query: query, events: &Conn{conn: nlConnEcho}}
+
+	var b bytes.Buffer
+	c.SetDebug(&b)
+	assert.Equal(t, &b, c.query.debug)
+	assert.Equal(t, &b, c.events.debug)
+
+	c.SetDumpRetries(2)
+	assert.Equal(t, 2, c.query.dumpRetries)
+
+	got, err := dumpIndices(c.Dump(dumpTestReq))
+	require.NoError(t, err)
+	assert.Len(t, got, 3)
+
+	got, err = dumpIndices(c.DumpContext(context.Background(), dumpTestReq))
+	require.NoError(t, err)
+	assert.Len(t, got, 3)
+
+	// Subscriptions use the event Conn, which doesn't prevent queries.
+	_, _, err = c.Subscribe(context.Background(), GroupsCT)
+	assert.Error(t, err, "nltest doesn't support joining groups")
+	assert.Empty(t, c.Groups())
+
+	c.events.isMulticast = true
+	_, err = dumpIndices(c.Dump(dumpTestReq))
+	assert.NoError(t, err)
+}
+
+func TestClientReadDeadline(t *testing.T) {
+	c, err := DialClient(nil)
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// IPCTNL_MSG_CT_GET_STATS, answered with a single message.
+	req, err := MarshalNetlink(Header{
+		SubsystemID: NFSubsysCTNetlink,
+		MessageType: 5,
+		Family:      ProtoIPv4,
+		Flags:       netlink.Request | netlink.Acknowledge,
+	}, nil)
+	require.NoError(t, err)
+
+	// subscriptionErr returns the error ending a subscription.
+	subscriptionErr := func(msgs <-chan Message, errs <-chan error) error {
+		for {
+			select {
+			case <-msgs:
+			case err := <-errs:
+				return err
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+
+	msgs, errs, err := c.Subscribe(ctx, GroupsCT)
+	if err != nil {
+		t.Skipf("conntrack groups unavailable: %v", err)
+	}
+
+	// A read deadline that has already passed ends the subscription, but
+	// doesn't affect queries on the request Conn.
+	require.NoError(t, c.SetReadDeadline(time.Unix(1, 0)))
+
+	_, err = c.QueryContext(ctx, req)
+	assert.NoError(t, err)
+
+	assert.ErrorIs(t, subscriptionErr(msgs, errs), os.ErrDeadlineExceeded)
+
+	// Wait for the subscription to end before starting the next one.
+	for range msgs {
+	}
+	for range errs {
+	}
+
+	// The same goes for SetDeadline, which sets the request Conn's write
+	// deadline only.
+	require.NoError(t, c.SetDeadline(time.Time{}))
+	msgs, errs, err = c.Subscribe(ctx, GroupsCT)
+	require.NoError(t, err)
+
+	require.NoError(t, c.SetDeadline(time.Now().Add(100*time.Millisecond)))
+
+	_, err = c.QueryContext(ctx, req)
+	assert.NoError(t, err)
+
+	assert.ErrorIs(t, subscriptionErr(msgs, errs), os.ErrDeadlineExceeded)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// A Description describes the Go code to generate for one or more C enums.
+// It is typically produced from a uapi header using -header and -describe,
+// annotated with attribute kinds and checked in next to the generated code.
+type Description struct {
+	Package string `json:"package"`
+	Enums   []Enum `json:"enums"`
+}
+
+// An Enum describes a single C enum and the Go type it is generated into.
+type Enum struct {
+	// Name of the enum in C, eg. ctattr_type.
+	C string `json:"c"`
+
+	// Name of the generated Go type, eg. AttributeType.
+	Type string `json:"type"`
+
+	// Underlying integer type of the Go type, uint16 if empty. Headers with
+	// negative or wider values get int32 or uint32.
+	Underlying string `json:"underlying,omitempty"`
+
+	// Prefix stripped from the C value names before converting them to Go,
+	// eg. CTA_.
+	Trim string `json:"trim,omitempty"`
+
+	// Prefix prepended to the Go names of the constants.
+	Prefix string `json:"prefix,omitempty"`
+
+	Values []Value `json:"values"`
+}
+
+// A Value is a single enumerator.
+type Value struct {
+	C     string `json:"c"`
+	Value int64  `json:"value"`
+
+	// Kind of the attribute's payload, one of the kinds known to kindTypes.
+	// Typed helpers are only generated for Values with a Kind.
+	Kind string `json:"kind,omitempty"`
+}
+
+// GoName returns the name of the Go constant for v within e.
+func (e Enum) GoName(v Value) string {
+	return e.Prefix + camelCase(strings.TrimPrefix(v.C, e.Trim))
+}
+
+// Signed reports whether the Go type of e has a signed underlying type.
+func (e Enum) Signed() bool {
+	return strings.HasPrefix(e.Underlying, "int")
+}
+
+// underlying returns the smallest underlying type for the values of e, starting
+// at uint16.
+func underlying(values []Value) string {
+	var typ string
+	for _, v := range values {
+		switch {
+		case v.Value < 0:
+			return "int32"
+		case v.Value > math.MaxUint16:
+			typ = "uint32"
+		}
+	}
+	return typ
+}
+
+// camelCase converts an upper snake case identifier like TUPLE_ORIG into
+// TupleOrig.
+func camelCase(s string) string {
+	var b strings.Builder
+	for _, w := range strings.Split(strings.ToLower(s), "_") {
+		if w == "" {
+			continue
+		}
+		b.WriteString(strings.ToUpper(w[:1]))
+		b.WriteString(w[1:])
+	}
+	return b.String()
+}
+
+// readDescription decodes a JSON Description from r and validates it.
+func readDescription(r io.Reader) (*Description, error) {
+	var d Description
+
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&d); err != nil {
+		return nil, fmt.Errorf("decoding description: %w", err)
+	}
+
+	if d.Package == "" {
+		return nil, fmt.Errorf("description: missing package name")
+	}
+
+	for _, e := range d.Enums {
+		if e.Type == "" {
+			return nil, fmt.Errorf("description: enum %s: missing Go type name", e.C)
+		}
+		for _, v := range e.Values {
+			if _, ok := kindTypes[v.Kind]; v.Kind != "" && !ok {
+				return nil, fmt.Errorf("description: enum %s: value %s: unknown kind %q", e.C, v.C, v.Kind)
+			}
+		}
+	}
+
+	return &d, nil
+}
+
+// writeDescription encodes d to w as indented JSON.
+func writeDescription(w io.Writer, d *Description) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(d)
+}
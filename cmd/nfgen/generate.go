@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"text/template"
+)
+
+// A kindType describes how to encode and decode a Value of a given kind.
+// Encode and Decode are template snippets executed with a helperData.
+type kindType struct {
+	GoType string
+	Import string
+
+	Encode string
+	Decode string
+}
+
+// kindTypes holds all attribute kinds supported in a Description.
+var kindTypes = map[string]kindType{
+	"u8": {
+		GoType: "uint8",
+		Encode: `Data: []byte{v}`,
+		Decode: `if a.Nested {
+		return 0, &netfilter.AttributeError{Op: "Uint8", Type: a.Type, Length: len(a.Data), Err: netfilter.ErrAttributeNested}
+	}
+	if len(a.Data) != 1 {
+		return 0, &netfilter.AttributeError{Op: "Uint8", Type: a.Type, Length: len(a.Data), Err: netfilter.ErrAttributeLength}
+	}
+	return a.Data[0], nil`,
+	},
+	"u16": {
+		GoType: "uint16",
+		Encode: `Data: netfilter.Uint16Bytes(v)`,
+		Decode: `return a.ParseUint16()`,
+	},
+	"u32": {
+		GoType: "uint32",
+		Encode: `Data: netfilter.Uint32Bytes(v)`,
+		Decode: `return a.ParseUint32()`,
+	},
+	"u64": {
+		GoType: "uint64",
+		Encode: `Data: netfilter.Uint64Bytes(v)`,
+		Decode: `return a.ParseUint64()`,
+	},
+	"string": {
+		GoType: "string",
+		Encode: `Data: netfilter.StringBytes(v)`,
+		Decode: `return a.ParseString()`,
+	},
+	"addr": {
+		GoType: "netip.Addr",
+		Import: "net/netip",
+		Encode: `Data: netfilter.AddrBytes(v)`,
+		Decode: `return a.ParseAddr()`,
+	},
+	"bitfield32": {
+		GoType: "netfilter.Bitfield32",
+		Encode: `Data: netfilter.Bitfield32Bytes(v)`,
+		Decode: `return a.ParseBitfield32()`,
+	},
+	"binary": {
+		GoType: "[]byte",
+		Encode: `Data: v`,
+		Decode: `if a.Nested {
+		return nil, &netfilter.AttributeError{
+			Op: "Bytes", Type: a.Type, Length: len(a.Data), Err: netfilter.ErrAttributeNested,
+		}
+	}
+	return a.Data, nil`,
+	},
+	// Attributes decoded using a NestingSchema hold Children without carrying
+	// the Nested flag.
+	"nested": {
+		GoType: "[]netfilter.Attribute",
+		Encode: `Nested: true, Children: v`,
+		Decode: `if !a.Nested && a.Children == nil {
+		return nil, &netfilter.AttributeError{
+			Op: "Nested", Type: a.Type, Length: len(a.Data), Err: netfilter.ErrAttributeNotNested,
+		}
+	}
+	return a.Children, nil`,
+	},
+}
+
+// helperData is passed to the templates of a single typed helper.
+type helperData struct {
+	Name string
+	C    string
+	Kind kindType
+}
+
+var fileTemplate = template.Must(template.New("file").Parse(`// Code generated by nfgen. DO NOT EDIT.
+
+package {{ .Package }}
+
+import (
+{{- range .Imports }}
+	"{{ . }}"
+{{- end }}
+{{- if .Netfilter }}
+
+	"github.com/ti-mo/netfilter"
+{{- end }}
+)
+{{ range $e := .Enums }}
+// {{ $e.Type }} is generated from enum {{ $e.C }}.
+type {{ $e.Type }} {{ or $e.Underlying "uint16" }}
+
+// enum {{ $e.C }}
+const (
+{{- range $e.Values }}
+	{{ $e.GoName . }} {{ $e.Type }} = {{ .Value }} // {{ .C }}
+{{- end }}
+)
+
+// String returns the Go name of the constant for t.
+func (t {{ $e.Type }}) String() string {
+	switch t {
+{{- range $e.Values }}
+	case {{ $e.GoName . }}:
+		return "{{ $e.GoName . }}"
+{{- end }}
+	}
+{{- if $e.Signed }}
+	return "{{ $e.Type }}(" + strconv.FormatInt(int64(t), 10) + ")"
+{{- else }}
+	return "{{ $e.Type }}(" + strconv.FormatUint(uint64(t), 10) + ")"
+{{- end }}
+}
+{{ end -}}
+{{ range .Helpers }}
+// New{{ .Name }} returns a {{ .C }} attribute holding v.
+func New{{ .Name }}(v {{ .Kind.GoType }}) netfilter.Attribute {
+	return netfilter.Attribute{Type: uint16({{ .Name }}), {{ .Kind.Encode }}}
+}
+
+// Parse{{ .Name }} decodes the payload of a {{ .C }} attribute.
+func Parse{{ .Name }}(a netfilter.Attribute) ({{ .Kind.GoType }}, error) {
+	{{ .Kind.Decode }}
+}
+{{ end -}}
+`))
+
+// generate renders Go source for the Description and formats it.
+func generate(d *Description) ([]byte, error) {
+	data := struct {
+		*Description
+		Imports   []string
+		Netfilter bool
+		Helpers   []helperData
+	}{Description: d}
+
+	imports := map[string]bool{"strconv": true}
+	for _, e := range d.Enums {
+		for _, v := range e.Values {
+			if v.Kind == "" {
+				continue
+			}
+
+			kt := kindTypes[v.Kind]
+			if kt.Import != "" {
+				imports[kt.Import] = true
+			}
+			data.Netfilter = true
+
+			data.Helpers = append(data.Helpers, helperData{
+				Name: e.GoName(v), C: v.C, Kind: kt,
+			})
+		}
+	}
+
+	// Standard library imports, in the order gofmt would sort them.
+	for _, imp := range []string{"net/netip", "strconv"} {
+		if imports[imp] {
+			data.Imports = append(data.Imports, imp)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := fileTemplate.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("executing template: %w", err)
+	}
+
+	b, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting generated code: %w\n%s", err, buf.Bytes())
+	}
+
+	return b, nil
+}
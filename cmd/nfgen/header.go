@@ -0,0 +1,244 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var (
+	reBlockComment = regexp.MustCompile(`(?s)/\*.*?\*/`)
+	reLineComment  = regexp.MustCompile(`//[^\n]*`)
+	rePreprocessor = regexp.MustCompile(`(?m)^\s*#.*$`)
+	reEnum         = regexp.MustCompile(`(?s)enum\s+(\w+)\s*\{(.*?)\}`)
+)
+
+// parseHeader extracts the named enums from the contents of a C header. If names
+// are given, only the enums with those names are returned. Other enums are
+// evaluated on a best-effort basis, since the selected enums may refer to their
+// values, and unsupported expressions in them are ignored. Enumerators starting
+// with a double underscore, like __CTA_MAX, are considered bookkeeping and
+// skipped, as are enumerators aliasing another name.
+func parseHeader(src string, names ...string) ([]Enum, error) {
+	src = reBlockComment.ReplaceAllString(src, "")
+	src = reLineComment.ReplaceAllString(src, "")
+	src = rePreprocessor.ReplaceAllString(src, "")
+
+	// Values of all enumerators seen so far, across enums.
+	global := make(map[string]int64)
+
+	var enums []Enum
+	for _, m := range reEnum.FindAllStringSubmatch(src, -1) {
+		selected := len(names) == 0 || slices.Contains(names, m[1])
+
+		e := Enum{C: m[1]}
+
+		known := make(map[string]int64)
+		next := int64(0)
+	items:
+		for _, item := range strings.Split(m[2], ",") {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+
+			name, expr, hasValue := strings.Cut(item, "=")
+			name, expr = strings.TrimSpace(name), strings.TrimSpace(expr)
+
+			value := next
+			if hasValue {
+				if v, ok := known[expr]; ok {
+					// Aliases like CTA_NAT = CTA_NAT_SRC don't get their own constant.
+					known[name] = v
+					global[name] = v
+					next = v + 1
+					continue
+				}
+
+				v, err := evalExpr(expr, global)
+				if err != nil {
+					if !selected {
+						break items
+					}
+					return nil, fmt.Errorf("enum %s: value %s: unsupported expression %q: %w", e.C, name, expr, err)
+				}
+				value = v
+			}
+
+			known[name] = value
+			global[name] = value
+			next = value + 1
+
+			if strings.HasPrefix(name, "__") {
+				continue
+			}
+
+			e.Values = append(e.Values, Value{C: name, Value: value})
+		}
+
+		if !selected {
+			continue
+		}
+
+		e.Trim = commonPrefix(e.Values)
+
+		enums = append(enums, e)
+	}
+
+	return enums, nil
+}
+
+// reToken matches a single token of an enumerator's value expression. Integer
+// literals may carry C suffixes like 1U, which are ignored.
+var reToken = regexp.MustCompile(`^\s*(?:(0[xX][0-9a-fA-F]+|[0-9]+)[uUlL]*|([A-Za-z_]\w*)|(<<|[-+|()]))`)
+
+// evalExpr evaluates the value expression of an enumerator. It supports
+// integer literals, names of enumerators in known, parentheses, negation and
+// the +, << and | operators, which covers the expressions found in uapi headers
+// like -1 and (1 << IPSET_FLAG_BIT_EXIST).
+func evalExpr(expr string, known map[string]int64) (int64, error) {
+	var tokens []string
+	for rest := expr; strings.TrimSpace(rest) != ""; {
+		m := reToken.FindStringSubmatch(rest)
+		if m == nil {
+			return 0, fmt.Errorf("unexpected %q", strings.TrimSpace(rest))
+		}
+		rest = rest[len(m[0]):]
+		tokens = append(tokens, strings.TrimSpace(m[0]))
+	}
+
+	p := exprParser{tokens: tokens, known: known}
+	v, err := p.or()
+	if err != nil {
+		return 0, err
+	}
+	if p.pos != len(p.tokens) {
+		return 0, fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+
+	return v, nil
+}
+
+// An exprParser is a recursive descent parser over the tokens of an
+// enumerator's value expression, see evalExpr.
+type exprParser struct {
+	tokens []string
+	pos    int
+	known  map[string]int64
+}
+
+// peek returns the current token, or an empty string at the end of the input.
+func (p *exprParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *exprParser) or() (int64, error) {
+	v, err := p.shift()
+	for err == nil && p.peek() == "|" {
+		p.pos++
+
+		var r int64
+		r, err = p.shift()
+		v |= r
+	}
+	return v, err
+}
+
+func (p *exprParser) shift() (int64, error) {
+	v, err := p.add()
+	for err == nil && p.peek() == "<<" {
+		p.pos++
+
+		var r int64
+		r, err = p.add()
+		if err == nil && (r < 0 || r > 63) {
+			err = fmt.Errorf("shift count %d out of range", r)
+		}
+		v <<= r
+	}
+	return v, err
+}
+
+func (p *exprParser) add() (int64, error) {
+	v, err := p.unary()
+	for err == nil && p.peek() == "+" {
+		p.pos++
+
+		var r int64
+		r, err = p.unary()
+		v += r
+	}
+	return v, err
+}
+
+func (p *exprParser) unary() (int64, error) {
+	if p.peek() == "-" {
+		p.pos++
+		v, err := p.unary()
+		return -v, err
+	}
+	return p.primary()
+}
+
+func (p *exprParser) primary() (int64, error) {
+	tok := p.peek()
+	p.pos++
+
+	switch {
+	case tok == "":
+		return 0, errors.New("unexpected end of expression")
+
+	case tok == "(":
+		v, err := p.or()
+		if err != nil {
+			return 0, err
+		}
+		if p.peek() != ")" {
+			return 0, errors.New("missing )")
+		}
+		p.pos++
+		return v, nil
+
+	case tok[0] >= '0' && tok[0] <= '9':
+		v, err := strconv.ParseInt(strings.TrimRight(tok, "uUlL"), 0, 64)
+		if err != nil {
+			return 0, err
+		}
+		return v, nil
+	}
+
+	if v, ok := p.known[tok]; ok {
+		return v, nil
+	}
+
+	return 0, fmt.Errorf("unknown name %s", tok)
+}
+
+// commonPrefix returns the longest underscore-terminated prefix shared by the
+// C names of all values.
+func commonPrefix(values []Value) string {
+	if len(values) == 0 {
+		return ""
+	}
+
+	p := values[0].C
+	for _, v := range values[1:] {
+		for !strings.HasPrefix(v.C, p) {
+			p = p[:len(p)-1]
+		}
+	}
+
+	// Only cut at word boundaries, so CTA_TIMEOUT and CTA_TIMESTAMP
+	// yield CTA_ rather than CTA_TIME.
+	if i := strings.LastIndex(p, "_"); i >= 0 {
+		return p[:i+1]
+	}
+
+	return ""
+}
@@ -0,0 +1,155 @@
+// Command nfgen generates Go constants, String methods and typed Attribute
+// helpers for Netfilter subsystem packages.
+//
+// Its input is either a uapi header or a JSON description file. Enums in a
+// header are turned into constants and String methods. Since headers carry no
+// information about attribute payloads, typed helpers are only generated from
+// description files, where each value can be annotated with a kind:
+// u8, u16, u32, u64, string, addr, bitfield32, binary or nested.
+//
+// A typical workflow starts by converting a header into a description skeleton:
+//
+//	nfgen -header nfnetlink_conntrack.h -enum ctattr_type=AttributeType -package conntrack -describe > conntrack.json
+//
+// After annotating the values in conntrack.json with their kinds, generate the
+// Go code from a go:generate directive in the subsystem package:
+//
+//	//go:generate go run github.com/ti-mo/netfilter/cmd/nfgen -desc conntrack.json -out attributes.go
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// enumFlags collects repeated -enum c_name=GoType flags.
+type enumFlags map[string]string
+
+func (e enumFlags) String() string { return fmt.Sprint(map[string]string(e)) }
+
+func (e enumFlags) Set(s string) error {
+	c, goType, ok := strings.Cut(s, "=")
+	if !ok || c == "" || goType == "" {
+		return fmt.Errorf("expected c_name=GoType, got %q", s)
+	}
+	e[c] = goType
+	return nil
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "nfgen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("nfgen", flag.ContinueOnError)
+
+	var (
+		header   = fs.String("header", "", "C header to read enums from")
+		desc     = fs.String("desc", "", "JSON description file to read")
+		pkg      = fs.String("package", "", "Go package name, required with -header")
+		out      = fs.String("out", "", "output file, stdout if empty")
+		describe = fs.Bool("describe", false, "emit a JSON description instead of Go code")
+		enums    = enumFlags{}
+	)
+	fs.Var(enums, "enum", "C enum to generate as c_name=GoType, repeatable, required with -header")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var d *Description
+	switch {
+	case *header != "" && *desc == "":
+		src, err := os.ReadFile(*header)
+		if err != nil {
+			return err
+		}
+
+		d, err = describeHeader(string(src), *pkg, enums)
+		if err != nil {
+			return err
+		}
+
+	case *desc != "" && *header == "":
+		f, err := os.Open(*desc)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		d, err = readDescription(f)
+		if err != nil {
+			return err
+		}
+
+	default:
+		return fmt.Errorf("exactly one of -header or -desc is required")
+	}
+
+	var buf bytes.Buffer
+	if *describe {
+		if err := writeDescription(&buf, d); err != nil {
+			return err
+		}
+	} else {
+		b, err := generate(d)
+		if err != nil {
+			return err
+		}
+		buf.Write(b)
+	}
+
+	if *out == "" {
+		_, err := stdout.Write(buf.Bytes())
+		return err
+	}
+
+	return os.WriteFile(*out, buf.Bytes(), 0o644)
+}
+
+// describeHeader builds a Description from the enums in the header src that
+// are selected by enums.
+func describeHeader(src, pkg string, enums enumFlags) (*Description, error) {
+	if pkg == "" {
+		return nil, fmt.Errorf("-package is required with -header")
+	}
+	if len(enums) == 0 {
+		return nil, fmt.Errorf("at least one -enum is required with -header")
+	}
+
+	names := make([]string, 0, len(enums))
+	for c := range enums {
+		names = append(names, c)
+	}
+
+	parsed, err := parseHeader(src, names...)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Description{Package: pkg}
+	for _, e := range parsed {
+		goType, ok := enums[e.C]
+		if !ok {
+			continue
+		}
+		delete(enums, e.C)
+
+		e.Type = goType
+		e.Underlying = underlying(e.Values)
+		d.Enums = append(d.Enums, e)
+	}
+
+	for c := range enums {
+		return nil, fmt.Errorf("enum %s not found in header", c)
+	}
+
+	return d, nil
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func TestParseHeader(t *testing.T) {
+	src, err := os.ReadFile("testdata/nfnetlink_test.h")
+	require.NoError(t, err)
+
+	enums, err := parseHeader(string(src))
+	require.NoError(t, err)
+	require.Len(t, enums, 2)
+
+	assert.Equal(t, Enum{
+		C:    "ctattr_type",
+		Trim: "CTA_",
+		Values: []Value{
+			{C: "CTA_UNSPEC", Value: 0},
+			{C: "CTA_TUPLE_ORIG", Value: 1},
+			{C: "CTA_STATUS", Value: 3},
+			{C: "CTA_HELP", Value: 4},
+			{C: "CTA_NAT_SRC", Value: 5},
+			{C: "CTA_TIMEOUT", Value: 6},
+			{C: "CTA_ZONE", Value: 18},
+			{C: "CTA_LABELS", Value: 19},
+		},
+	}, enums[0])
+
+	assert.Equal(t, "CTA_IGNORED_", enums[1].Trim)
+
+	enums, err = parseHeader(string(src), "ctattr_ignored")
+	require.NoError(t, err)
+	require.Len(t, enums, 1)
+	assert.Equal(t, "ctattr_ignored", enums[0].C)
+}
+
+func TestParseHeaderExpressions(t *testing.T) {
+	src, err := os.ReadFile("testdata/expr_test.h")
+	require.NoError(t, err)
+
+	// Unselected enums are not evaluated.
+	enums, err := parseHeader(string(src), "nft_verdicts", "ipset_cmd_flags", "nft_data_types",
+		"ip_conntrack_info", "ip_set_kopt")
+	require.NoError(t, err)
+	require.Len(t, enums, 5)
+
+	assert.Equal(t, []Value{
+		{C: "NFT_CONTINUE", Value: -1},
+		{C: "NFT_BREAK", Value: -2},
+		{C: "NFT_JUMP", Value: -3},
+	}, enums[0].Values)
+
+	assert.Equal(t, []Value{
+		{C: "IPSET_FLAG_BIT_EXIST", Value: 0},
+		{C: "IPSET_FLAG_EXIST", Value: 1},
+		{C: "IPSET_FLAG_BIT_LIST_HEADER", Value: 2},
+		{C: "IPSET_FLAG_LIST_HEADER", Value: 4},
+		{C: "IPSET_FLAG_BOTH", Value: 5},
+	}, enums[1].Values)
+
+	assert.Equal(t, []Value{
+		{C: "NFT_DATA_VALUE", Value: 0},
+		{C: "NFT_DATA_VERDICT", Value: 0xffffff00},
+	}, enums[2].Values)
+
+	assert.Equal(t, Value{C: "IP_CT_ESTABLISHED_REPLY", Value: 3}, enums[3].Values[2])
+
+	// Enumerators of other enums can be referenced.
+	assert.Equal(t, []Value{{C: "IPSET_INV_MATCH", Value: 4}}, enums[4].Values)
+
+	_, err = parseHeader(string(src))
+	assert.ErrorContains(t, err, "UNSUPPORTED_SIZE")
+
+	for _, expr := range []string{"", "1 <<", "(1", "1 2", "1 << 64", "UNKNOWN", "1 * 2"} {
+		_, err := evalExpr(expr, nil)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestRunHeaderExpressions(t *testing.T) {
+	var out bytes.Buffer
+	require.NoError(t, run([]string{
+		"-header", "testdata/expr_test.h",
+		"-package", "nftables",
+		"-enum", "nft_verdicts=Verdict",
+		"-enum", "nft_data_types=DataType",
+	}, &out))
+
+	assert.Contains(t, out.String(), "type Verdict int32")
+	assert.Contains(t, out.String(), "Continue Verdict = -1 // NFT_CONTINUE")
+	assert.Contains(t, out.String(), `"Verdict(" + strconv.FormatInt(int64(t), 10) + ")"`)
+	assert.Contains(t, out.String(), "type DataType uint32")
+	assert.Contains(t, out.String(), "Verdict DataType = 4294967040 // NFT_DATA_VERDICT")
+}
+
+func TestCommonPrefix(t *testing.T) {
+	assert.Equal(t, "CTA_", commonPrefix([]Value{{C: "CTA_TIMEOUT"}, {C: "CTA_TIMESTAMP"}}))
+	assert.Equal(t, "CTA_TUPLE_", commonPrefix([]Value{{C: "CTA_TUPLE_ORIG"}, {C: "CTA_TUPLE_REPLY"}}))
+	assert.Equal(t, "", commonPrefix([]Value{{C: "FOO"}, {C: "BAR"}}))
+	assert.Equal(t, "", commonPrefix(nil))
+}
+
+func TestRunHeader(t *testing.T) {
+	var out bytes.Buffer
+	require.NoError(t, run([]string{
+		"-header", "testdata/nfnetlink_test.h",
+		"-package", "conntrack",
+		"-enum", "ctattr_type=AttributeType",
+		"-describe",
+	}, &out))
+
+	d, err := readDescription(&out)
+	require.NoError(t, err)
+	assert.Equal(t, "conntrack", d.Package)
+	require.Len(t, d.Enums, 1)
+	assert.Equal(t, "AttributeType", d.Enums[0].Type)
+
+	out.Reset()
+	require.NoError(t, run([]string{
+		"-header", "testdata/nfnetlink_test.h",
+		"-package", "conntrack",
+		"-enum", "ctattr_type=AttributeType",
+	}, &out))
+	assert.Contains(t, out.String(), "TupleOrig AttributeType = 1  // CTA_TUPLE_ORIG")
+	assert.NotContains(t, out.String(), "netfilter")
+
+	for _, args := range [][]string{
+		{},
+		{"-header", "a", "-desc", "b"},
+		{"-header", "testdata/nfnetlink_test.h", "-enum", "ctattr_type=AttributeType"},
+		{"-header", "testdata/nfnetlink_test.h", "-package", "conntrack"},
+		{"-header", "testdata/nfnetlink_test.h", "-package", "conntrack", "-enum", "missing=Missing"},
+		{"-enum", "invalid"},
+		{"-desc", "testdata/missing.json"},
+	} {
+		assert.Error(t, run(args, &out), strings.Join(args, " "))
+	}
+}
+
+func TestRunDescriptionGolden(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out.go")
+	require.NoError(t, run([]string{"-desc", "testdata/test.json", "-out", out}, nil))
+
+	got, err := os.ReadFile(out)
+	require.NoError(t, err)
+
+	golden := "testdata/test.golden"
+	if *update {
+		require.NoError(t, os.WriteFile(golden, got, 0o644))
+	}
+
+	want, err := os.ReadFile(golden)
+	require.NoError(t, err)
+	assert.Equal(t, string(want), string(got))
+}
+
+// TestGeneratedCode compiles the golden file as a package of the module and
+// runs the tests in testdata/generated_test.go.in against it.
+func TestGeneratedCode(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping go test of generated code in short mode")
+	}
+
+	// Directories starting with an underscore are ignored by ./... patterns.
+	dir, err := os.MkdirTemp(".", "_generated")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	for src, dst := range map[string]string{
+		"testdata/test.golden":          "attributes.go",
+		"testdata/generated_test.go.in": "attributes_test.go",
+	} {
+		b, err := os.ReadFile(src)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, dst), b, 0o644))
+	}
+
+	out, err := exec.Command("go", "test", "./"+dir).CombinedOutput()
+	require.NoError(t, err, string(out))
+}
+
+func TestReadDescriptionErrors(t *testing.T) {
+	for _, s := range []string{
+		`{`,
+		`{"enums": []}`,
+		`{"package": "p", "enums": [{"c": "e"}]}`,
+		`{"package": "p", "enums": [{"c": "e", "type": "E", "values": [{"c": "V", "kind": "float"}]}]}`,
+		`{"package": "p", "unknown": 1}`,
+	} {
+		_, err := readDescription(strings.NewReader(s))
+		assert.Error(t, err, s)
+	}
+}
@@ -0,0 +1,38 @@
+/* SPDX-License-Identifier: GPL-2.0 WITH Linux-syscall-note */
+#ifndef _EXPR_TEST_H
+#define _EXPR_TEST_H
+
+enum nft_verdicts {
+	NFT_CONTINUE	= -1,
+	NFT_BREAK	= -2,
+	NFT_JUMP	= -3,
+};
+
+enum ipset_cmd_flags {
+	IPSET_FLAG_BIT_EXIST	= 0,
+	IPSET_FLAG_EXIST	= (1 << IPSET_FLAG_BIT_EXIST),
+	IPSET_FLAG_BIT_LIST_HEADER = 2,
+	IPSET_FLAG_LIST_HEADER	= (1U << IPSET_FLAG_BIT_LIST_HEADER),
+	IPSET_FLAG_BOTH		= (IPSET_FLAG_EXIST | IPSET_FLAG_LIST_HEADER),
+};
+
+enum nft_data_types {
+	NFT_DATA_VALUE,
+	NFT_DATA_VERDICT	= 0xffffff00U,
+};
+
+enum ip_conntrack_info {
+	IP_CT_ESTABLISHED,
+	IP_CT_IS_REPLY = 3,
+	IP_CT_ESTABLISHED_REPLY = IP_CT_ESTABLISHED + IP_CT_IS_REPLY,
+};
+
+enum ip_set_kopt {
+	IPSET_INV_MATCH = (1 << IPSET_FLAG_BIT_LIST_HEADER),
+};
+
+enum unsupported {
+	UNSUPPORTED_SIZE	= sizeof(int),
+};
+
+#endif
@@ -0,0 +1,24 @@
+/* SPDX-License-Identifier: GPL-2.0 WITH Linux-syscall-note */
+#ifndef _NFNETLINK_TEST_H
+#define _NFNETLINK_TEST_H
+
+enum ctattr_type {
+	CTA_UNSPEC,
+	CTA_TUPLE_ORIG,		/* nested */
+	CTA_STATUS = 3,
+	CTA_HELP,
+	CTA_NAT_SRC,
+#define CTA_NAT	CTA_NAT_SRC	/* backwards compatibility */
+	CTA_TIMEOUT,
+	CTA_ZONE = 0x12,
+	CTA_LABELS,
+	CTA_NAT_V4 = CTA_NAT_SRC, // alias
+	__CTA_MAX
+};
+#define CTA_MAX (__CTA_MAX - 1)
+
+enum ctattr_ignored {
+	CTA_IGNORED_UNSPEC,
+};
+
+#endif
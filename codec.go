@@ -0,0 +1,378 @@
+package netfilter
+
+import (
+	"bytes"
+	"fmt"
+	"net/netip"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MarshalStruct marshals a struct (or a pointer to one) into a list of
+// Attributes, driven by `nfattr` struct tags. Fields without a tag are ignored.
+//
+// A tag starts with the attribute type, optionally followed by a comma-separated
+// list of options:
+//
+//	Zone    uint16      `nfattr:"18,netbyteorder"`
+//	Tuple   Tuple       `nfattr:"1,nested"`
+//	Helper  *string     `nfattr:"5"`
+//	Labels  []uint32    `nfattr:"22,omitempty"`
+//
+// Supported options are:
+//   - nested: the field is a struct encoded as nested attributes, required for struct fields
+//   - netbyteorder: set the NetByteOrder flag on the attribute
+//   - omitempty: omit the attribute if the field holds its type's zero value
+//
+// Integer fields are encoded big-endian using their fixed width, strings are
+// NUL-terminated, netip.Addr fields are encoded as 4 or 16 bytes depending on
+// the address family, Bitfield32 fields use native byte order and []byte fields
+// are copied verbatim. Nil pointers are omitted and any other slice field yields
+// one attribute per element.
+//
+// The zero netip.Addr has no wire format and results in an error, whether it's
+// held by a field, a pointer or a slice element. Use omitempty or a nil pointer
+// to leave out an address.
+func MarshalStruct(v any) ([]Attribute, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil, fmt.Errorf("MarshalStruct: nil %s", rv.Type())
+		}
+		rv = rv.Elem()
+	}
+
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("MarshalStruct: expected struct, got %s", rv.Type())
+	}
+
+	return marshalStruct(rv)
+}
+
+// UnmarshalStruct decodes a list of Attributes into the struct pointed to by v,
+// following the `nfattr` struct tag conventions of MarshalStruct. Attributes
+// without a corresponding field are ignored. Pointer fields are allocated when
+// their attribute is present and slice fields collect repeated attributes.
+func UnmarshalStruct(attrs []Attribute, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("UnmarshalStruct: expected non-nil pointer to struct, got %T", v)
+	}
+
+	return unmarshalStruct(attrs, rv.Elem())
+}
+
+// codecField describes a tagged struct field.
+type codecField struct {
+	index int
+	name  string
+
+	attrType     uint16
+	nested       bool
+	netByteOrder bool
+	omitEmpty    bool
+}
+
+// codecFields caches the parsed struct tags per struct type.
+var codecFields sync.Map // map[reflect.Type][]codecField
+
+func fieldsOf(t reflect.Type) ([]codecField, error) {
+	if f, ok := codecFields.Load(t); ok {
+		return f.([]codecField), nil
+	}
+
+	var fields []codecField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+
+		tag, ok := sf.Tag.Lookup("nfattr")
+		if !ok || tag == "-" {
+			continue
+		}
+
+		if !sf.IsExported() {
+			return nil, fmt.Errorf("field %s.%s: tagged field must be exported", t, sf.Name)
+		}
+
+		opts := strings.Split(tag, ",")
+		typ, err := strconv.ParseUint(opts[0], 10, 14)
+		if err != nil {
+			return nil, fmt.Errorf("field %s.%s: invalid attribute type %q", t, sf.Name, opts[0])
+		}
+
+		f := codecField{index: i, name: sf.Name, attrType: uint16(typ)}
+		for _, o := range opts[1:] {
+			switch o {
+			case "nested":
+				f.nested = true
+			case "netbyteorder":
+				f.netByteOrder = true
+			case "omitempty":
+				f.omitEmpty = true
+			default:
+				return nil, fmt.Errorf("field %s.%s: unknown option %q", t, sf.Name, o)
+			}
+		}
+
+		if f.nested && f.netByteOrder {
+			return nil, fmt.Errorf("field %s.%s: %w", t, sf.Name, ErrInvalidAttributeFlags)
+		}
+
+		fields = append(fields, f)
+	}
+
+	codecFields.Store(t, fields)
+
+	return fields, nil
+}
+
+var (
+	typeAddr       = reflect.TypeOf(netip.Addr{})
+	typeBitfield32 = reflect.TypeOf(Bitfield32{})
+)
+
+// isScalarStruct returns true for struct types that are encoded as a single
+// payload rather than as nested attributes.
+func isScalarStruct(t reflect.Type) bool {
+	return t == typeAddr || t == typeBitfield32
+}
+
+// isBytes returns true if t is a slice of bytes, which is treated as a single
+// opaque payload instead of a list of repeated attributes.
+func isBytes(t reflect.Type) bool {
+	return t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8
+}
+
+func marshalStruct(rv reflect.Value) ([]Attribute, error) {
+	fields, err := fieldsOf(rv.Type())
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := make([]Attribute, 0, len(fields))
+	for _, f := range fields {
+		fv := rv.Field(f.index)
+
+		if f.omitEmpty && fv.IsZero() {
+			continue
+		}
+
+		// Nil pointers are always omitted, non-nil pointers are marshaled
+		// like their underlying value.
+		if fv.Kind() == reflect.Pointer {
+			if fv.IsNil() {
+				continue
+			}
+			fv = fv.Elem()
+		}
+
+		// Slices other than []byte produce one attribute per element.
+		if fv.Kind() == reflect.Slice && !isBytes(fv.Type()) {
+			for i := 0; i < fv.Len(); i++ {
+				a, err := marshalField(f, fv.Index(i))
+				if err != nil {
+					return nil, err
+				}
+				attrs = append(attrs, a)
+			}
+			continue
+		}
+
+		a, err := marshalField(f, fv)
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, a)
+	}
+
+	return attrs, nil
+}
+
+// marshalField encodes a single value into an Attribute described by f.
+func marshalField(f codecField, v reflect.Value) (Attribute, error) {
+	a := Attribute{Type: f.attrType, NetByteOrder: f.netByteOrder}
+
+	// Elements of a slice of pointers.
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return Attribute{}, fmt.Errorf("field %s: nil element", f.name)
+		}
+		v = v.Elem()
+	}
+
+	if v.Kind() == reflect.Struct && !isScalarStruct(v.Type()) {
+		if !f.nested {
+			return Attribute{}, fmt.Errorf("field %s: struct field requires the nested option", f.name)
+		}
+
+		children, err := marshalStruct(v)
+		if err != nil {
+			return Attribute{}, err
+		}
+
+		a.Nested = true
+		a.Children = children
+
+		return a, nil
+	}
+
+	if f.nested {
+		return Attribute{}, fmt.Errorf("field %s: nested option on non-struct type %s", f.name, v.Type())
+	}
+
+	switch v.Kind() {
+	case reflect.Uint8, reflect.Int8:
+		a.Data = []byte{uint8(intBits(v))}
+	case reflect.Uint16, reflect.Int16:
+		a.Data = Uint16Bytes(uint16(intBits(v)))
+	case reflect.Uint32, reflect.Int32:
+		a.Data = Uint32Bytes(uint32(intBits(v)))
+	case reflect.Uint64, reflect.Int64:
+		a.Data = Uint64Bytes(intBits(v))
+	case reflect.String:
+		a.PutString(v.String())
+	case reflect.Slice:
+		if !isBytes(v.Type()) {
+			return Attribute{}, fmt.Errorf("field %s: unsupported type %s", f.name, v.Type())
+		}
+		a.Data = bytes.Clone(v.Bytes())
+		if a.Data == nil {
+			a.Data = []byte{}
+		}
+	case reflect.Struct:
+		switch x := v.Interface().(type) {
+		case Bitfield32:
+			a.PutBitfield32(x)
+		case netip.Addr:
+			if !x.IsValid() {
+				return Attribute{}, fmt.Errorf("field %s: invalid netip.Addr", f.name)
+			}
+			a.PutAddr(x)
+		}
+	default:
+		return Attribute{}, fmt.Errorf("field %s: unsupported type %s", f.name, v.Type())
+	}
+
+	return a, nil
+}
+
+// intBits returns the bits of an integer reflect.Value as a uint64.
+func intBits(v reflect.Value) uint64 {
+	if v.CanInt() {
+		return uint64(v.Int())
+	}
+	return v.Uint()
+}
+
+func unmarshalStruct(attrs []Attribute, rv reflect.Value) error {
+	fields, err := fieldsOf(rv.Type())
+	if err != nil {
+		return err
+	}
+
+	for _, a := range attrs {
+		for _, f := range fields {
+			if f.attrType != a.Type {
+				continue
+			}
+
+			if err := unmarshalField(f, a, rv.Field(f.index)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// unmarshalField decodes Attribute a into the field value v.
+func unmarshalField(f codecField, a Attribute, v reflect.Value) error {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+
+	// Append a new element to slices other than []byte.
+	if v.Kind() == reflect.Slice && !isBytes(v.Type()) {
+		ev := reflect.New(v.Type().Elem()).Elem()
+		if err := unmarshalField(f, a, ev); err != nil {
+			return err
+		}
+		v.Set(reflect.Append(v, ev))
+		return nil
+	}
+
+	if v.Kind() == reflect.Struct && !isScalarStruct(v.Type()) {
+		if !a.hasChildren() {
+			return fmt.Errorf("field %s: %w", f.name, attributeError("Nested", a, ErrAttributeNotNested))
+		}
+		return unmarshalStruct(a.Children, v)
+	}
+
+	var err error
+	switch v.Kind() {
+	case reflect.Uint8, reflect.Int8:
+		if err = checkScalar("Uint8", a.Type, a.Nested, a.Data, 1); err == nil {
+			setIntBits(v, uint64(a.Data[0]))
+		}
+	case reflect.Uint16, reflect.Int16:
+		var u uint16
+		if u, err = a.ParseUint16(); err == nil {
+			setIntBits(v, uint64(u))
+		}
+	case reflect.Uint32, reflect.Int32:
+		var u uint32
+		if u, err = a.ParseUint32(); err == nil {
+			setIntBits(v, uint64(u))
+		}
+	case reflect.Uint64, reflect.Int64:
+		var u uint64
+		if u, err = a.ParseUint64(); err == nil {
+			setIntBits(v, u)
+		}
+	case reflect.String:
+		var s string
+		if s, err = a.ParseString(); err == nil {
+			v.SetString(s)
+		}
+	case reflect.Slice:
+		if a.Nested {
+			err = attributeError("Bytes", a, ErrAttributeNested)
+			break
+		}
+		v.SetBytes(bytes.Clone(a.Data))
+	case reflect.Struct:
+		var x any
+		if v.Type() == typeBitfield32 {
+			x, err = a.ParseBitfield32()
+		} else {
+			x, err = a.ParseAddr()
+		}
+		if err == nil {
+			v.Set(reflect.ValueOf(x))
+		}
+	default:
+		err = fmt.Errorf("unsupported type %s", v.Type())
+	}
+
+	if err != nil {
+		return fmt.Errorf("field %s: %w", f.name, err)
+	}
+
+	return nil
+}
+
+// setIntBits stores the low bits of u into the integer reflect.Value v.
+func setIntBits(v reflect.Value, u uint64) {
+	if v.CanInt() {
+		// Sign-extend from the width of the field.
+		shift := 64 - v.Type().Bits()
+		v.SetInt(int64(u<<shift) >> shift)
+		return
+	}
+	v.SetUint(u)
+}
@@ -0,0 +1,195 @@
+package netfilter
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type codecTuple struct {
+	Src netip.Addr `nfattr:"1"`
+	Dst netip.Addr `nfattr:"2"`
+}
+
+type codecTest struct {
+	U8     uint8        `nfattr:"1"`
+	I16    int16        `nfattr:"2,netbyteorder"`
+	U32    uint32       `nfattr:"3"`
+	I64    int64        `nfattr:"4"`
+	Name   string       `nfattr:"5"`
+	Raw    []byte       `nfattr:"6"`
+	Tuple  codecTuple   `nfattr:"7,nested"`
+	Opt    *uint16      `nfattr:"8"`
+	Labels []uint32     `nfattr:"9"`
+	Tuples []codecTuple `nfattr:"10,nested"`
+	Empty  uint32       `nfattr:"11,omitempty"`
+	Flags  Bitfield32   `nfattr:"12"`
+
+	Ignored string
+	Skipped uint8 `nfattr:"-"`
+}
+
+func TestCodecTwoWay(t *testing.T) {
+	opt := uint16(0x1234)
+	in := codecTest{
+		U8:    1,
+		I16:   -2,
+		U32:   3,
+		I64:   -4,
+		Name:  "ftp",
+		Raw:   []byte{0xde, 0xad},
+		Tuple: codecTuple{Src: netip.MustParseAddr("10.0.0.1"), Dst: netip.MustParseAddr("fd00::1")},
+		Opt:   &opt,
+		Labels: []uint32{
+			5, 6,
+		},
+		Tuples: []codecTuple{
+			{Src: netip.MustParseAddr("1.2.3.4"), Dst: netip.MustParseAddr("5.6.7.8")},
+		},
+		Flags:   Bitfield32{Value: 1, Selector: 3},
+		Ignored: "ignored",
+		Skipped: 1,
+	}
+
+	want := []Attribute{
+		{Type: 1, Data: []byte{1}},
+		{Type: 2, Data: []byte{0xff, 0xfe}, NetByteOrder: true},
+		{Type: 3, Data: Uint32Bytes(3)},
+		{Type: 4, Data: Uint64Bytes(0xfffffffffffffffc)},
+		{Type: 5, Data: []byte("ftp\x00")},
+		{Type: 6, Data: []byte{0xde, 0xad}},
+		{Type: 7, Nested: true, Children: []Attribute{
+			{Type: 1, Data: []byte{10, 0, 0, 1}},
+			{Type: 2, Data: netip.MustParseAddr("fd00::1").AsSlice()},
+		}},
+		{Type: 8, Data: Uint16Bytes(0x1234)},
+		{Type: 9, Data: Uint32Bytes(5)},
+		{Type: 9, Data: Uint32Bytes(6)},
+		{Type: 10, Nested: true, Children: []Attribute{
+			{Type: 1, Data: []byte{1, 2, 3, 4}},
+			{Type: 2, Data: []byte{5, 6, 7, 8}},
+		}},
+		{Type: 12, Data: Bitfield32Bytes(Bitfield32{Value: 1, Selector: 3})},
+	}
+
+	attrs, err := MarshalStruct(&in)
+	require.NoError(t, err)
+	assert.Equal(t, want, attrs)
+
+	// Round-trip through the wire format to pick up the decoder's view.
+	b, err := MarshalAttributes(attrs)
+	require.NoError(t, err)
+	attrs, err = UnmarshalAttributes(b)
+	require.NoError(t, err)
+
+	var out codecTest
+	require.NoError(t, UnmarshalStruct(attrs, &out))
+
+	in.Ignored, in.Skipped = "", 0
+	assert.Equal(t, in, out)
+}
+
+func TestCodecOptional(t *testing.T) {
+	type optional struct {
+		A *uint16     `nfattr:"1"`
+		B uint32      `nfattr:"2,omitempty"`
+		C *codecTuple `nfattr:"3,nested"`
+		D []uint8     `nfattr:"4"`
+		E uint8       `nfattr:"5"`
+	}
+
+	// Nil pointers and empty omitempty fields are omitted, zero values are not.
+	attrs, err := MarshalStruct(optional{})
+	require.NoError(t, err)
+	assert.Equal(t, []Attribute{{Type: 4, Data: []byte{}}, {Type: 5, Data: []byte{0}}}, attrs)
+
+	var out optional
+	require.NoError(t, UnmarshalStruct(attrs, &out))
+	assert.Nil(t, out.A)
+	assert.Nil(t, out.C)
+
+	// Present attributes allocate pointer fields.
+	require.NoError(t, UnmarshalStruct([]Attribute{
+		{Type: 1, Data: Uint16Bytes(1)},
+		{Type: 3, Nested: true},
+	}, &out))
+	require.NotNil(t, out.A)
+	assert.Equal(t, uint16(1), *out.A)
+	assert.Equal(t, &codecTuple{}, out.C)
+
+	// Zero Addrs are only omitted using omitempty or a nil pointer.
+	src := netip.MustParseAddr("10.0.0.1")
+	attrs, err = MarshalStruct(struct {
+		A netip.Addr  `nfattr:"1,omitempty"`
+		B *netip.Addr `nfattr:"2"`
+		C netip.Addr  `nfattr:"3"`
+	}{C: src})
+	require.NoError(t, err)
+	assert.Equal(t, []Attribute{{Type: 3, Data: src.AsSlice()}}, attrs)
+
+	// Zero Addrs cannot be marshaled otherwise.
+	for _, v := range []any{
+		struct {
+			T codecTuple `nfattr:"1,nested"`
+		}{},
+		struct {
+			A *netip.Addr `nfattr:"1"`
+		}{A: &netip.Addr{}},
+		struct {
+			A []netip.Addr `nfattr:"1"`
+		}{A: []netip.Addr{{}}},
+	} {
+		_, err = MarshalStruct(v)
+		assert.Error(t, err)
+	}
+}
+
+func TestCodecErrors(t *testing.T) {
+	_, err := MarshalStruct(1)
+	assert.Error(t, err)
+
+	_, err = MarshalStruct((*codecTest)(nil))
+	assert.Error(t, err)
+
+	assert.Error(t, UnmarshalStruct(nil, codecTest{}))
+
+	_, err = MarshalStruct(struct {
+		A uint8 `nfattr:"foo"`
+	}{})
+	assert.Error(t, err)
+
+	_, err = MarshalStruct(struct {
+		A uint8 `nfattr:"1,bar"`
+	}{})
+	assert.Error(t, err)
+
+	_, err = MarshalStruct(struct {
+		A codecTuple `nfattr:"1"`
+	}{})
+	assert.Error(t, err)
+
+	_, err = MarshalStruct(struct {
+		A uint8 `nfattr:"1,nested"`
+	}{})
+	assert.Error(t, err)
+
+	_, err = MarshalStruct(struct {
+		A map[int]int `nfattr:"1"`
+	}{})
+	assert.Error(t, err)
+
+	var out codecTest
+	err = UnmarshalStruct([]Attribute{{Type: 3, Data: []byte{1}}}, &out)
+	assert.ErrorIs(t, err, ErrAttributeLength)
+
+	err = UnmarshalStruct([]Attribute{{Type: 7, Data: []byte{1}}}, &out)
+	assert.ErrorIs(t, err, ErrAttributeNotNested)
+
+	err = UnmarshalStruct([]Attribute{{Type: 5, Nested: true}}, &out)
+	assert.ErrorIs(t, err, ErrAttributeNested)
+
+	err = UnmarshalStruct([]Attribute{{Type: 7, Nested: true, Children: []Attribute{{Type: 1, Data: []byte{1}}}}}, &out)
+	assert.ErrorIs(t, err, ErrAttributeLength)
+}
@@ -1,11 +1,17 @@
 package netfilter
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/pkg/errors"
-
 	"github.com/mdlayher/netlink"
 	"golang.org/x/sys/unix"
 )
@@ -15,11 +21,48 @@ type Conn struct {
 	conn *netlink.Conn
 
 	// Marks the Conn as being attached to one or more multicast groups,
-	// it can no longer be used for any queries for its remaining lifetime.
+	// it can't be used for any queries until it has left all groups.
 	isMulticast bool
 
-	// Mutex to protect isMulticast
+	// Multicast groups the Conn is currently attached to.
+	groups map[NetlinkGroup]struct{}
+
+	// Set when the Conn has left its last group, until no more notifications
+	// are pending on the socket, see checkUsable.
+	draining atomic.Bool
+
+	// Set when the remainder of a dump couldn't be read, see drainDump.
+	undrained atomic.Bool
+
+	// Set while a subscription started by Subscribe is active.
+	subscribed atomic.Bool
+
+	// Writer receiving a rendering of every message sent and received,
+	// see SetDebug.
+	debug io.Writer
+
+	// Amount of times Query restarts an interrupted dump, see SetDumpRetries.
+	dumpRetries int
+
+	// Mutex to protect isMulticast, groups, debug and dumpRetries
 	mu sync.RWMutex
+
+	// Held for reading by queries, whose responses are demultiplexed by
+	// sequence number, and for writing by requests reading the socket
+	// themselves, so they don't consume each other's replies.
+	reqMu sync.RWMutex
+
+	// Protects seq, waiters, reader and interrupted, see roundTrip.
+	muxMu       sync.Mutex
+	seq         uint32
+	waiters     map[uint32]*waiter
+	reader      chan struct{}
+	interrupted bool
+
+	// Override receiveRaw and pending in tests, since nltest doesn't support
+	// SyscallConn.
+	recvRaw    func() ([]netlink.Message, error)
+	pendingRaw func() (bool, error)
 }
 
 // Dial opens a new Netlink connection to the Netfilter subsystem
@@ -33,6 +76,11 @@ func Dial(config *netlink.Config) (*Conn, error) {
 		return nil, err
 	}
 
+	// Request extended acknowledgements, so the kernel can describe why it
+	// rejected a request and point out the offending attribute. Kernels that
+	// don't support them simply send regular acknowledgements.
+	_ = c.conn.SetOption(netlink.ExtendedAcknowledge, true)
+
 	return &c, nil
 }
 
@@ -42,30 +90,95 @@ func (c *Conn) Close() error {
 }
 
 // Query sends a Netfilter message over Netlink and validates the response.
-// The call will fail if the Conn is marked as Multicast. Any errors returned
-// from the underlying Netlink layer are wrapped using pkg/errors.Wrap(). Use
-// errors.Cause() to unwrap to compare to Errno.
+// The call will fail with ErrConnIsMulticast if the Conn is attached to any
+// multicast groups, or ErrMulticastPending if it has left all groups but unread
+// notifications remain.
+// Errors returned from the underlying Netlink layer are wrapped in an *OpError,
+// use errors.Is to compare them to an Errno like unix.ENOENT.
+//
+// The Conn assigns each request its own sequence number, replacing any sequence
+// number set in nlm by the caller. The response carries the assigned one.
+//
+// If nlm is a dump request and the kernel reports the dump was interrupted by a
+// concurrent change, Query returns the response along with an error wrapping
+// ErrDumpInterrupted. See SetDumpRetries for restarting such dumps instead.
 func (c *Conn) Query(nlm netlink.Message) ([]netlink.Message, error) {
+	return c.QueryContext(context.Background(), nlm)
+}
+
+// QueryContext is like Query, but gives up waiting for the response once ctx is
+// done, returning an *OpError wrapping ctx.Err(). The socket read is interrupted
+// by moving the Conn's read deadline into the past, after which the deadline is
+// cleared, overriding any deadline set using SetReadDeadline.
+//
+// Query and QueryContext are safe for concurrent use. Concurrent queries are
+// pipelined over the Conn's socket, instead of waiting for each other's
+// responses. To tell their responses apart, each query is sent with a sequence
+// number assigned by the Conn, replacing the one set in nlm.
+func (c *Conn) QueryContext(ctx context.Context, nlm netlink.Message) ([]netlink.Message, error) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	if c.isMulticast {
-		return nil, errConnIsMulticast
+	if err := c.checkUsable(); err != nil {
+		return nil, err
 	}
 
-	ret, err := c.conn.Execute(nlm)
-	if err != nil {
-		return nil, errors.Wrap(err, "netfilter query")
+	c.reqMu.RLock()
+	defer c.reqMu.RUnlock()
+
+	for attempt := 0; ; attempt++ {
+		trace(c.debug, "send", nlm)
+
+		ret, interrupted, err := c.roundTrip(ctx, nlm)
+		if err != nil {
+			return nil, requestError("query", nlm, err)
+		}
+
+		trace(c.debug, "recv", ret...)
+
+		if !interrupted {
+			return ret, nil
+		}
+
+		if attempt >= c.dumpRetries {
+			return ret, &OpError{Op: "query", Header: requestHeader(nlm), Err: ErrDumpInterrupted}
+		}
 	}
+}
+
+// dumpInterrupted returns true if any of msgs has the DumpInterrupted flag set.
+// The Done message of a multipart response isn't part of msgs as returned by
+// netlink.Conn.Execute, so a flag set only on it is missed.
+func dumpInterrupted(msgs []netlink.Message) bool {
+	for _, m := range msgs {
+		if m.Header.Flags&netlink.DumpInterrupted != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// SetDumpRetries makes Query restart a dump up to n times when the kernel
+// reports it was interrupted by a concurrent change to the dumped table, so
+// callers receive a consistent snapshot. Only if the last attempt is also
+// interrupted is an error wrapping ErrDumpInterrupted returned. Defaults to 0,
+// never restarting dumps.
+//
+// Dump and DumpContext don't restart dumps, since they have already yielded
+// part of the response by the time an interruption is detected.
+func (c *Conn) SetDumpRetries(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	return ret, nil
+	c.dumpRetries = n
 }
 
 // JoinGroups attaches the Netlink socket to one or more Netfilter multicast groups.
-// Marks the Conn as Multicast, meaning it can no longer be used for any queries.
+// Marks the Conn as Multicast, meaning it can't be used for any queries until it
+// has left all groups again.
 func (c *Conn) JoinGroups(groups []NetlinkGroup) error {
 	if len(groups) == 0 {
-		return errNoMulticastGroups
+		return ErrNoMulticastGroups
 	}
 
 	// Write lock
@@ -75,18 +188,24 @@ func (c *Conn) JoinGroups(groups []NetlinkGroup) error {
 	for _, group := range groups {
 		err := c.conn.JoinGroup(uint32(group))
 		if err != nil {
-			return err
+			return &OpError{Op: "join group " + group.String(), Err: err}
 		}
-	}
 
-	// Mark the Conn as being attached to a multicast group
-	c.isMulticast = true
+		// Mark the Conn as being attached to a multicast group
+		if c.groups == nil {
+			c.groups = make(map[NetlinkGroup]struct{})
+		}
+		c.groups[group] = struct{}{}
+		c.isMulticast = true
+		c.draining.Store(false)
+	}
 
 	return nil
 }
 
 // LeaveGroups detaches the Netlink socket from one or more Netfilter multicast groups.
-// Does not remove the Multicast flag, open a separate Conn for making queries instead.
+// Once the Conn has left all groups, it can be used for queries again after all
+// notifications it received have been read using Receive.
 func (c *Conn) LeaveGroups(groups []NetlinkGroup) error {
 	// Write lock
 	c.mu.Lock()
@@ -95,19 +214,188 @@ func (c *Conn) LeaveGroups(groups []NetlinkGroup) error {
 	for _, group := range groups {
 		err := c.conn.LeaveGroup(uint32(group))
 		if err != nil {
-			return err
+			return &OpError{Op: "leave group " + group.String(), Err: err}
 		}
+
+		delete(c.groups, group)
+	}
+
+	if c.isMulticast && len(c.groups) == 0 {
+		c.isMulticast = false
+		c.draining.Store(true)
 	}
 
 	return nil
 }
 
+// Groups returns the multicast groups the Conn is currently attached to, in
+// ascending order.
+func (c *Conn) Groups() []NetlinkGroup {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return slices.Sorted(maps.Keys(c.groups))
+}
+
+// checkUsable returns an error if the Conn can't be used for queries because
+// it is attached to multicast groups, or because it has left all groups but
+// notifications remain to be read. It also fails if the Conn was left unusable
+// by a dump. Must be called with c.mu held.
+func (c *Conn) checkUsable() error {
+	if c.undrained.Load() {
+		return ErrDumpNotDrained
+	}
+
+	if c.isMulticast {
+		return ErrConnIsMulticast
+	}
+
+	if !c.draining.Load() {
+		return nil
+	}
+
+	pending, err := c.pending()
+	if err != nil {
+		return &OpError{Op: "peek", Err: err}
+	}
+	if pending {
+		return ErrMulticastPending
+	}
+
+	// No more notifications can arrive once all groups have been left.
+	c.draining.Store(false)
+
+	return nil
+}
+
 // Receive executes a blocking read on the underlying Netlink socket and returns a Message.
 func (c *Conn) Receive() ([]netlink.Message, error) {
-	return c.conn.Receive()
+	return c.ReceiveContext(context.Background())
+}
+
+// ReceiveContext is like Receive, but gives up waiting once ctx is done,
+// returning an *OpError wrapping ctx.Err(). Like QueryContext, cancellation
+// clears any deadline set using SetReadDeadline.
+func (c *Conn) ReceiveContext(ctx context.Context) ([]netlink.Message, error) {
+	var msgs []netlink.Message
+	err := c.withContext(ctx, func() (err error) {
+		msgs, err = c.conn.Receive()
+		return err
+	})
+	if err != nil {
+		return nil, &OpError{Op: "receive", Err: err}
+	}
+
+	c.mu.RLock()
+	w := c.debug
+	c.mu.RUnlock()
+
+	trace(w, "recv", msgs...)
+
+	return msgs, nil
+}
+
+// withContext calls fn, interrupting any socket read it blocks on once ctx is
+// done by moving the Conn's read deadline into the past. The read deadline is
+// cleared afterwards, overriding any deadline set using SetReadDeadline. If fn
+// fails after ctx is done, ctx.Err() is returned instead of fn's error.
+func (c *Conn) withContext(ctx context.Context, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Background contexts can never be done.
+	if ctx.Done() == nil {
+		return fn()
+	}
+
+	interrupted := make(chan struct{})
+	stop := context.AfterFunc(ctx, func() {
+		_ = c.conn.SetReadDeadline(time.Unix(1, 0))
+		close(interrupted)
+	})
+
+	err := fn()
+	if stop() {
+		return err
+	}
+
+	// ctx was done while fn ran, reset the deadline once it's been set.
+	<-interrupted
+	_ = c.conn.SetReadDeadline(time.Time{})
+
+	if err != nil {
+		return ctx.Err()
+	}
+
+	return nil
+}
+
+// requestError wraps an error returned in response to request nlm in an OpError,
+// mapping any extended acknowledgement to the request's attributes.
+func requestError(op string, nlm netlink.Message, err error) error {
+	oe := &OpError{Op: op, Header: requestHeader(nlm), Err: err}
+
+	var ne *netlink.OpError
+	if !errors.As(err, &ne) {
+		return oe
+	}
+
+	oe.Message = ne.Message
+	oe.Offset = ne.Offset
+
+	// The offset is relative to the start of the request's netlink header.
+	if off := ne.Offset - nlmsgHeaderLen - nfHeaderLen; off >= 0 && len(nlm.Data) >= nfHeaderLen {
+		oe.Path = attributePath(nlm.Data[nfHeaderLen:], off)
+	}
+
+	return oe
+}
+
+// requestHeader returns the Netfilter Header of a request for use in an OpError.
+// Requests without a Netfilter header only yield the netlink header's fields.
+func requestHeader(nlm netlink.Message) Header {
+	var h Header
+	_ = h.unmarshal(nlm)
+	return h
+}
+
+// SetDebug makes the Conn write a symbolic rendering of every message it sends
+// and receives to w, using the names registered with RegisterNames. Each message
+// is preceded by a line indicating its direction. Passing a nil io.Writer
+// disables debug output.
+func (c *Conn) SetDebug(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.debug = w
+}
+
+// traceMu serializes writes by trace, so the output of concurrent requests,
+// possibly on different Conns sharing a writer, doesn't interleave.
+var traceMu sync.Mutex
+
+// trace writes msgs to w if it is not nil, see SetDebug. Each message is
+// rendered into a buffer first and written to w using a single Write.
+func trace(w io.Writer, dir string, msgs ...netlink.Message) {
+	if w == nil {
+		return
+	}
+
+	var b bytes.Buffer
+	for _, m := range msgs {
+		b.Reset()
+		fmt.Fprintf(&b, "%s:\n", dir)
+		_ = FprintNetlink(&b, m)
+
+		traceMu.Lock()
+		_, _ = w.Write(b.Bytes())
+		traceMu.Unlock()
+	}
 }
 
-// IsMulticast returns the Conn's Multicast flag. It is set by calling Listen().
+// IsMulticast returns the Conn's Multicast flag. It is set by calling JoinGroups,
+// and cleared once the Conn has left all groups.
 func (c *Conn) IsMulticast() bool {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
@@ -3,6 +3,8 @@
 package netfilter
 
 import (
+	"context"
+	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -30,20 +32,135 @@ func TestConnIntegrationJoinLeaveGroup(t *testing.T) {
 
 }
 
+func TestConnIntegrationLeaveAllGroups(t *testing.T) {
+	c, err := Dial(nil)
+	require.NoError(t, err, "opening Conn")
+
+	req, err := MarshalNetlink(Header{
+		SubsystemID: NFSubsysCTNetlink,
+		MessageType: 1,
+		Family:      ProtoIPv4,
+		Flags:       netlink.Request | netlink.Dump,
+	}, nil)
+	require.NoError(t, err, "marshaling dump request")
+
+	err = c.JoinGroups(GroupsCT)
+	require.NoError(t, err, "JoinGroup")
+	require.Equal(t, GroupsCT, c.Groups())
+
+	_, err = c.Query(req)
+	require.ErrorIs(t, err, ErrConnIsMulticast)
+
+	// Leaving some groups keeps the Conn in multicast mode.
+	err = c.LeaveGroups(GroupsCT[:1])
+	require.NoError(t, err, "LeaveGroup")
+	require.Equal(t, GroupsCT[1:], c.Groups())
+	require.True(t, c.IsMulticast())
+
+	err = c.LeaveGroups(GroupsCT[1:])
+	require.NoError(t, err, "LeaveGroup")
+	require.Empty(t, c.Groups())
+	require.False(t, c.IsMulticast())
+
+	// No notifications were received, so the Conn can be queried right away.
+	_, err = c.Query(req)
+	require.NoError(t, err, "Query")
+
+	err = c.Close()
+	require.NoError(t, err, "closing Conn")
+}
+
 func TestConnIntegrationBadGroups(t *testing.T) {
 	c, err := Dial(nil)
 	require.NoError(t, err, "opening Conn")
 
 	err = c.JoinGroups(badGroup)
-	require.EqualError(t, err, "netlink join-group: setsockopt: invalid argument")
+	require.EqualError(t, err, "netfilter join group NetlinkGroup(255): netlink join-group: setsockopt: invalid argument")
 
 	err = c.LeaveGroups(badGroup)
-	require.EqualError(t, err, "netlink leave-group: setsockopt: invalid argument")
+	require.EqualError(t, err,
+		"netfilter leave group NetlinkGroup(255): netlink leave-group: setsockopt: invalid argument")
 
 	err = c.Close()
 	require.NoError(t, err, "closing Conn")
 }
 
+func TestConnIntegrationSubscribe(t *testing.T) {
+	c, err := Dial(nil)
+	require.NoError(t, err, "opening Conn")
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	msgs, errs, err := c.Subscribe(ctx, GroupsCT)
+	require.NoError(t, err, "Subscribe")
+
+	cancel()
+
+	// Both channels must be closed once ctx is done.
+	for range msgs {
+	}
+	for range errs {
+	}
+
+	err = c.Close()
+	require.NoError(t, err, "closing Conn")
+}
+
+func TestConnIntegrationWatch(t *testing.T) {
+	req, err := MarshalNetlink(Header{SubsystemID: NFSubsysCTNetlink, MessageType: 1, Family: ProtoIPv4}, nil)
+	require.NoError(t, err, "marshaling dump request")
+
+	// Identify conntrack entries by their original tuple.
+	cache := NewCache(
+		func(m Message) string { return fmt.Sprint(m.Attributes[0]) },
+		func(m Message) bool { return m.Header.MessageType == 2 },
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	events, errs, err := Watch(ctx, nil, GroupsCT, req, cache)
+	require.NoError(t, err, "Watch")
+
+	cancel()
+
+	// Both channels must be closed once ctx is done.
+	for range events {
+	}
+	for range errs {
+	}
+}
+
+func TestConnIntegrationClient(t *testing.T) {
+	c, err := DialClient(nil)
+	require.NoError(t, err, "opening Client")
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	msgs, errs, err := c.Subscribe(ctx, GroupsCT)
+	require.NoError(t, err, "Subscribe")
+	require.Equal(t, GroupsCT, c.Groups())
+
+	// Queries can be made while subscribed.
+	req, err := MarshalNetlink(Header{SubsystemID: NFSubsysCTNetlink, MessageType: 1, Family: ProtoIPv4}, nil)
+	require.NoError(t, err, "marshaling dump request")
+
+	for _, err := range c.Dump(req) {
+		require.NoError(t, err, "Dump")
+	}
+
+	_, _, err = c.Subscribe(ctx, GroupsCT)
+	require.ErrorIs(t, err, ErrSubscribed)
+
+	cancel()
+	for range msgs {
+	}
+	for range errs {
+	}
+
+	err = c.Close()
+	require.NoError(t, err, "closing Client")
+}
+
 func TestConnIntegrationSetOption(t *testing.T) {
 	c, err := Dial(nil)
 	require.NoError(t, err, "opening Conn")
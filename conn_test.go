@@ -1,16 +1,20 @@
 package netfilter
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
 	"testing"
 	"time"
 
-	"github.com/pkg/errors"
-
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/mdlayher/netlink"
+	"github.com/mdlayher/netlink/nlenc"
 	"github.com/mdlayher/netlink/nltest"
+	"golang.org/x/sys/unix"
 )
 
 var (
@@ -71,14 +75,91 @@ func TestConnQuery(t *testing.T) {
 	assert.NoError(t, err, "query error")
 
 	_, err = connErr.Query(nlMsgReqAck)
-	opErr, ok := errors.Cause(err).(*netlink.OpError)
-	require.True(t, ok)
+	var opErr *netlink.OpError
+	require.ErrorAs(t, err, &opErr)
 	assert.EqualError(t, opErr, "netlink receive: "+errNetlinkTest)
 
 	_, err = connErrMsg.Query(nlMsgReqAck)
-	opErr, ok = errors.Cause(err).(*netlink.OpError)
-	require.True(t, ok)
+	require.ErrorAs(t, err, &opErr)
 	assert.EqualError(t, opErr, "netlink receive: errno -1")
+	assert.EqualError(t, err, "netfilter query: netlink receive: errno -1")
+}
+
+func TestConnQueryOpError(t *testing.T) {
+	c := Conn{conn: nltest.Dial(func(req []netlink.Message) ([]netlink.Message, error) {
+		return nltest.Error(int(unix.ENOENT), req)
+	})}
+
+	req, err := MarshalNetlink(Header{
+		SubsystemID: NFSubsysCTNetlink,
+		MessageType: 1,
+		Family:      ProtoIPv4,
+		Flags:       netlink.Request | netlink.Acknowledge,
+	}, nil)
+	require.NoError(t, err)
+
+	_, err = c.Query(req)
+	assert.ErrorIs(t, err, unix.ENOENT)
+
+	var opErr *OpError
+	require.ErrorAs(t, err, &opErr)
+	assert.Equal(t, "query", opErr.Op)
+	assert.Equal(t, NFSubsysCTNetlink, opErr.Header.SubsystemID)
+	assert.Equal(t, MessageType(1), opErr.Header.MessageType)
+	assert.Equal(t, ProtoIPv4, opErr.Header.Family)
+
+	// Requests without a Netfilter header still carry the netlink header's fields.
+	_, err = c.Query(nlMsgReqAck)
+	require.ErrorAs(t, err, &opErr)
+	assert.Equal(t, Header{Flags: netlink.Request | netlink.Acknowledge}, opErr.Header)
+}
+
+func TestConnQueryExtendedAck(t *testing.T) {
+	req, err := MarshalNetlink(Header{
+		SubsystemID: NFSubsysCTNetlink,
+		Flags:       netlink.Request | netlink.Acknowledge,
+	}, []Attribute{
+		{Type: 1, Data: Uint32Bytes(1)},
+		{Type: 2, Nested: true, Children: []Attribute{
+			{Type: 1, Data: Uint32Bytes(2)},
+			{Type: 2, Data: Uint16Bytes(3)},
+		}},
+	})
+	require.NoError(t, err)
+
+	// Offset of attribute 2/2 from the start of the request's netlink header.
+	const off = nlmsgHeaderLen + nfHeaderLen + 20
+
+	c := Conn{conn: nltest.Dial(func(reqs []netlink.Message) ([]netlink.Message, error) {
+		b, err := reqs[0].MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+
+		ae := netlink.NewAttributeEncoder()
+		ae.String(1, "invalid zone")
+		ae.Uint32(2, off)
+		tlvs, err := ae.Encode()
+		if err != nil {
+			return nil, err
+		}
+
+		data := append(nlenc.Int32Bytes(-int32(unix.EINVAL)), b...)
+		return []netlink.Message{{
+			Header: netlink.Header{Type: netlink.Error, Flags: netlink.AcknowledgeTLVs},
+			Data:   append(data, tlvs...),
+		}}, nil
+	})}
+
+	_, err = c.Query(req)
+	assert.ErrorIs(t, err, unix.EINVAL)
+
+	var opErr *OpError
+	require.ErrorAs(t, err, &opErr)
+	assert.Equal(t, "invalid zone", opErr.Message)
+	assert.Equal(t, off, opErr.Offset)
+	assert.Equal(t, []uint16{2, 2}, opErr.Path)
+	assert.Contains(t, err.Error(), "netfilter query: attribute 2/2: ")
 }
 
 func TestConnQueryMulticast(t *testing.T) {
@@ -88,10 +169,46 @@ func TestConnQueryMulticast(t *testing.T) {
 	assert.Equal(t, connMulticast.IsMulticast(), true)
 
 	_, err := connMulticast.Query(nlMsgReqAck)
-	assert.EqualError(t, err, errConnIsMulticast.Error())
+	assert.ErrorIs(t, err, ErrConnIsMulticast)
 
 	err = connMulticast.JoinGroups(nil)
-	assert.EqualError(t, err, errNoMulticastGroups.Error())
+	assert.ErrorIs(t, err, ErrNoMulticastGroups)
+}
+
+func TestConnQueryMulticastPending(t *testing.T) {
+	// Conn that has left all groups, with notifications pending until the
+	// first receive.
+	pending, calls := true, 0
+	c := Conn{conn: nlConnEcho, pendingRaw: func() (bool, error) {
+		calls++
+		return pending, nil
+	}}
+	c.draining.Store(true)
+
+	assert.False(t, c.IsMulticast())
+	assert.Empty(t, c.Groups())
+
+	_, err := c.Query(nlMsgReqAck)
+	assert.ErrorIs(t, err, ErrMulticastPending)
+
+	pending = false
+	_, err = c.Query(nlMsgReqAck)
+	require.NoError(t, err)
+
+	// The socket is not checked again once it has been drained.
+	_, err = c.Query(nlMsgReqAck)
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+
+	// Errors checking for notifications are returned.
+	c.draining.Store(true)
+	c.pendingRaw = func() (bool, error) { return false, unix.EBADF }
+
+	_, err = c.Query(nlMsgReqAck)
+	var oe *OpError
+	require.ErrorAs(t, err, &oe)
+	assert.Equal(t, "peek", oe.Op)
+	assert.ErrorIs(t, err, unix.EBADF)
 }
 
 func TestConnReceive(t *testing.T) {
@@ -105,6 +222,72 @@ func TestConnReceive(t *testing.T) {
 	}
 }
 
+func TestConnDebug(t *testing.T) {
+	c := Conn{conn: nltest.Dial(func(req []netlink.Message) ([]netlink.Message, error) {
+		return req, nil
+	})}
+
+	var b bytes.Buffer
+	c.SetDebug(&b)
+
+	req, err := MarshalNetlink(Header{SubsystemID: NFSubsysQueue, Flags: netlink.Request},
+		[]Attribute{{Type: 1, Data: []byte{1}}})
+	require.NoError(t, err)
+
+	_, err = c.Query(req)
+	require.NoError(t, err)
+
+	want := "send:\nNFSubsysQueue type 0 family=ProtoUnspec version=0 resource=0 flags=request\n  1: 01\n"
+	assert.Equal(t, want+"recv:\n"+want[len("send:\n"):], b.String())
+
+	// Disable debug output.
+	b.Reset()
+	c.SetDebug(nil)
+
+	_, err = c.Query(req)
+	require.NoError(t, err)
+	assert.Zero(t, b.Len())
+}
+
+// writeRecorder records the data passed to every call to Write.
+type writeRecorder struct {
+	writes []string
+}
+
+func (w *writeRecorder) Write(b []byte) (int, error) {
+	w.writes = append(w.writes, string(b))
+	return len(b), nil
+}
+
+func TestConnDebugConcurrent(t *testing.T) {
+	c := pipeTestConn(func(req netlink.Message) [][]netlink.Message {
+		return [][]netlink.Message{{req}}
+	})
+
+	var w writeRecorder
+	c.SetDebug(&w)
+
+	req, err := MarshalNetlink(Header{SubsystemID: NFSubsysQueue}, []Attribute{{Type: 1, Data: []byte{1}}})
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := c.Query(req)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	// Every message is written in one piece.
+	require.Len(t, w.writes, 32)
+	for _, s := range w.writes {
+		assert.Regexp(t, `^(send|recv):\n[^:]+\n  1: 01\n$`, s)
+	}
+}
+
 func TestConnDeadline(t *testing.T) {
 	c, err := Dial(nil)
 	require.NoError(t, err, "opening Conn")
@@ -126,3 +309,121 @@ func TestConnBuffers(t *testing.T) {
 
 	require.NoError(t, c.Close(), "closing Conn")
 }
+
+func TestConnQueryContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := connEcho.QueryContext(ctx, nlMsgReqAck)
+
+	var oe *OpError
+	require.ErrorAs(t, err, &oe)
+	assert.Equal(t, "query", oe.Op)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// A context that isn't done doesn't affect the query.
+	ctx, cancel = context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	_, err = connEcho.QueryContext(ctx, nlMsgReqAck)
+	assert.NoError(t, err)
+}
+
+func TestConnReceiveContext(t *testing.T) {
+	c, err := Dial(nil)
+	require.NoError(t, err)
+	defer c.Close()
+
+	// Nothing is ever sent to the socket, so the read must be interrupted by
+	// the context's deadline.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err = c.ReceiveContext(ctx)
+
+	var oe *OpError
+	require.ErrorAs(t, err, &oe)
+	assert.Equal(t, "receive", oe.Op)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// The interrupting deadline must be cleared afterwards.
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err = c.ReceiveContext(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestConnQueryDumpInterrupted(t *testing.T) {
+	// Connection whose dumps are interrupted the first intr times.
+	var calls, intr int
+	c := Conn{conn: nltest.Dial(func(req []netlink.Message) ([]netlink.Message, error) {
+		calls++
+
+		m := netlink.Message{Header: netlink.Header{Sequence: req[0].Header.Sequence}, Data: []byte{0, 0, 0, 0}}
+		if calls <= intr {
+			m.Header.Flags |= netlink.DumpInterrupted
+		}
+		return nltest.Multipart([]netlink.Message{m, {Header: netlink.Header{Sequence: req[0].Header.Sequence}}})
+	})}
+
+	req := netlink.Message{Header: netlink.Header{Flags: netlink.Request | netlink.Dump}, Data: []byte{0, 0, 0, 0}}
+
+	intr = 1
+	msgs, err := c.Query(req)
+	var oe *OpError
+	require.ErrorAs(t, err, &oe)
+	assert.Equal(t, "query", oe.Op)
+	assert.ErrorIs(t, err, ErrDumpInterrupted)
+	assert.Len(t, msgs, 1, "inconsistent response must be returned")
+	assert.Equal(t, 1, calls)
+
+	// Restart the dump until it's consistent.
+	calls, intr = 0, 2
+	c.SetDumpRetries(2)
+
+	msgs, err = c.Query(req)
+	require.NoError(t, err)
+	assert.Len(t, msgs, 1)
+	assert.Equal(t, 3, calls)
+
+	// Give up after exhausting all retries.
+	calls, intr = 0, 5
+
+	_, err = c.Query(req)
+	assert.ErrorIs(t, err, ErrDumpInterrupted)
+	assert.Equal(t, 3, calls)
+
+	// Only the Done message is flagged when the change happened after the last
+	// data message was dumped.
+	calls = 0
+	pc := pipeTestConn(func(req netlink.Message) [][]netlink.Message {
+		calls++
+
+		seq := req.Header.Sequence
+		done := netlink.Message{
+			Header: netlink.Header{Type: netlink.Done, Flags: netlink.Multi, Sequence: seq},
+			Data:   []byte{0, 0, 0, 0},
+		}
+		if calls == 1 {
+			done.Header.Flags |= netlink.DumpInterrupted
+		}
+
+		return [][]netlink.Message{
+			{{Header: netlink.Header{Flags: netlink.Multi, Sequence: seq}, Data: []byte{0, 0, 0, 0}}},
+			{done},
+		}
+	})
+
+	msgs, err = pc.Query(req)
+	assert.ErrorIs(t, err, ErrDumpInterrupted)
+	assert.Len(t, msgs, 1)
+
+	pc.SetDumpRetries(1)
+	calls = 0
+
+	msgs, err = pc.Query(req)
+	require.NoError(t, err)
+	assert.Len(t, msgs, 1)
+	assert.Equal(t, 2, calls)
+}
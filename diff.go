@@ -0,0 +1,156 @@
+package netfilter
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// ChangeKind describes how an Attribute differs between two Attribute trees.
+type ChangeKind uint8
+
+// Kinds of changes reported by Diff and Cache.
+const (
+	ChangeAdded ChangeKind = iota + 1
+	ChangeRemoved
+	ChangeModified
+)
+
+// String returns the name of the ChangeKind.
+func (k ChangeKind) String() string {
+	switch k {
+	case ChangeAdded:
+		return "added"
+	case ChangeRemoved:
+		return "removed"
+	case ChangeModified:
+		return "modified"
+	default:
+		return fmt.Sprintf("ChangeKind(%d)", uint8(k))
+	}
+}
+
+// A Change is a single difference between two Attribute trees, as reported
+// by Diff.
+type Change struct {
+	Kind ChangeKind
+
+	// Attribute types leading from the top level of the tree up to and
+	// including the changed attribute.
+	Path []uint16
+
+	// The attribute in the old and new tree. Old is nil for added attributes
+	// and New is nil for removed attributes. They point into the trees passed
+	// to Diff.
+	Old, New *Attribute
+}
+
+// String returns a short description of the Change, e.g. "modified 1/2/3".
+func (c Change) String() string {
+	return fmt.Sprintf("%s %s", c.Kind, formatPath(c.Path))
+}
+
+// Diff returns the differences between the Attribute trees old and new.
+//
+// Attributes are matched by their type and the order in which they appear
+// among the attributes of the same type at their level, so the n-th
+// attribute of a given type in old is compared against the n-th attribute of
+// that type in new. The relative order of attributes of different types is
+// not significant.
+//
+// Nested attributes present in both trees are descended into, reporting
+// changes to their children rather than the parent itself, and their Data is
+// ignored since it may not reflect their Children. Attributes are reported as
+// modified if their payloads differ, if their NetByteOrder or Nested flags
+// differ, or if one of them holds nested attributes and the other doesn't.
+//
+// Changes are ordered like the attributes in old, followed by attributes
+// only present in new.
+func Diff(old, new []Attribute) []Change {
+	var changes []Change
+	diff(old, new, nil, func(c Change) bool {
+		changes = append(changes, c)
+		return true
+	})
+
+	return changes
+}
+
+// Equal reports whether the Attribute trees a and b are equal, which is the
+// case if Diff(a, b) returns no changes.
+func Equal(a, b []Attribute) bool {
+	return diff(a, b, nil, func(Change) bool { return false })
+}
+
+// diff calls fn for every Change between old and new, with path being the
+// path of their parent. It stops and returns false as soon as fn returns false.
+func diff(old, new []Attribute, path []uint16, fn func(Change) bool) bool {
+	// Amount of attributes of each type seen in old so far.
+	seen := make(map[uint16]int)
+
+	for i := range old {
+		o := &old[i]
+		n := nthOfType(new, o.Type, seen[o.Type])
+		seen[o.Type]++
+
+		if n == nil {
+			if !fn(Change{Kind: ChangeRemoved, Path: appendPath(path, o.Type), Old: o}) {
+				return false
+			}
+			continue
+		}
+
+		if o.Nested == n.Nested && o.hasChildren() && n.hasChildren() {
+			if !diff(o.Children, n.Children, appendPath(path, o.Type), fn) {
+				return false
+			}
+			continue
+		}
+
+		if !attributeEqual(o, n) {
+			if !fn(Change{Kind: ChangeModified, Path: appendPath(path, o.Type), Old: o, New: n}) {
+				return false
+			}
+		}
+	}
+
+	// Any attributes in new beyond the amount of their type in old were added.
+	for i := range new {
+		n := &new[i]
+		if seen[n.Type] > 0 {
+			seen[n.Type]--
+			continue
+		}
+
+		if !fn(Change{Kind: ChangeAdded, Path: appendPath(path, n.Type), New: n}) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// attributeEqual compares the flags and payloads of two attributes, without
+// descending into nested attributes.
+func attributeEqual(a, b *Attribute) bool {
+	return a.Type == b.Type &&
+		a.Nested == b.Nested &&
+		a.NetByteOrder == b.NetByteOrder &&
+		a.hasChildren() == b.hasChildren() &&
+		bytes.Equal(a.Data, b.Data)
+}
+
+// nthOfType returns a pointer to the n-th (zero-indexed) Attribute of type t
+// in attrs, or nil if there are no more than n such attributes.
+func nthOfType(attrs []Attribute, t uint16, n int) *Attribute {
+	for i := range attrs {
+		if attrs[i].Type != t {
+			continue
+		}
+		if n == 0 {
+			return &attrs[i]
+		}
+		n--
+	}
+
+	return nil
+}
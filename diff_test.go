@@ -0,0 +1,136 @@
+package netfilter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new []Attribute
+		changes  []Change
+	}{
+		{
+			name: "equal",
+			old:  pathTestTree(),
+			new:  pathTestTree(),
+		},
+		{
+			name: "stale parent data",
+			old:  pathTestTree(),
+			new: func() []Attribute {
+				attrs := pathTestTree()
+				attrs[0].Data = nil
+				return attrs
+			}(),
+		},
+		{
+			name: "reordered types",
+			old:  []Attribute{{Type: 1, Data: []byte{1}}, {Type: 2, Data: []byte{2}}},
+			new:  []Attribute{{Type: 2, Data: []byte{2}}, {Type: 1, Data: []byte{1}}},
+		},
+		{
+			name: "nil and empty data",
+			old:  []Attribute{{Type: 1}},
+			new:  []Attribute{{Type: 1, Data: []byte{}}},
+		},
+		{
+			name: "modified nested",
+			old:  pathTestTree(),
+			new: func() []Attribute {
+				attrs := pathTestTree()
+				FindAttribute(attrs, 2, 1, 2).Data = []byte{10, 0, 0, 3}
+				return attrs
+			}(),
+			changes: []Change{
+				{Kind: ChangeModified, Path: []uint16{2, 1, 2}},
+			},
+		},
+		{
+			name: "repeated attributes",
+			old:  pathTestTree(),
+			new: func() []Attribute {
+				attrs := pathTestTree()
+				attrs[3].Data = Uint32Bytes(4)
+				return append(attrs, Attribute{Type: 3, Data: Uint32Bytes(5)})
+			}(),
+			changes: []Change{
+				{Kind: ChangeModified, Path: []uint16{3}},
+				{Kind: ChangeAdded, Path: []uint16{3}},
+			},
+		},
+		{
+			name: "added and removed",
+			old:  pathTestTree(),
+			new: func() []Attribute {
+				attrs, _ := DeleteAttribute(pathTestTree(), 1, 2)
+				return SetAttribute(attrs, Attribute{Type: 3, Data: []byte{1}}, 2, 1)
+			}(),
+			changes: []Change{
+				{Kind: ChangeRemoved, Path: []uint16{1, 2}},
+				{Kind: ChangeAdded, Path: []uint16{2, 1, 3}},
+			},
+		},
+		{
+			name: "netbyteorder",
+			old:  []Attribute{{Type: 1, Data: Uint16Bytes(1)}},
+			new:  []Attribute{{Type: 1, Data: Uint16Bytes(1), NetByteOrder: true}},
+			changes: []Change{
+				{Kind: ChangeModified, Path: []uint16{1}},
+			},
+		},
+		{
+			name: "nested flag",
+			old:  []Attribute{{Type: 1, Nested: true, Children: []Attribute{{Type: 1}}}},
+			new:  []Attribute{{Type: 1, Children: []Attribute{{Type: 1}}}},
+			changes: []Change{
+				{Kind: ChangeModified, Path: []uint16{1}},
+			},
+		},
+		{
+			name: "nested becomes scalar",
+			old:  []Attribute{{Type: 1, Nested: true}},
+			new:  []Attribute{{Type: 1, Data: []byte{1}}},
+			changes: []Change{
+				{Kind: ChangeModified, Path: []uint16{1}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes := Diff(tt.old, tt.new)
+			require.Len(t, changes, len(tt.changes))
+
+			for i, c := range changes {
+				assert.Equal(t, tt.changes[i].Kind, c.Kind)
+				assert.Equal(t, tt.changes[i].Path, c.Path)
+
+				assert.Equal(t, c.Kind == ChangeAdded, c.Old == nil)
+				assert.Equal(t, c.Kind == ChangeRemoved, c.New == nil)
+			}
+
+			assert.Equal(t, len(tt.changes) == 0, Equal(tt.old, tt.new))
+		})
+	}
+}
+
+func TestDiffPointers(t *testing.T) {
+	old := pathTestTree()
+	new := pathTestTree()
+	new[2].Data = Uint32Bytes(10)
+
+	changes := Diff(old, new)
+	require.Len(t, changes, 1)
+	assert.Same(t, &old[2], changes[0].Old)
+	assert.Same(t, &new[2], changes[0].New)
+}
+
+func TestChangeString(t *testing.T) {
+	c := Change{Kind: ChangeRemoved, Path: []uint16{1, 2}}
+	assert.Equal(t, "removed 1/2", c.String())
+	assert.Equal(t, "ChangeKind(0)", ChangeKind(0).String())
+}
@@ -0,0 +1,178 @@
+package netfilter
+
+import (
+	"context"
+	"iter"
+	"time"
+
+	"github.com/mdlayher/netlink"
+)
+
+// dumpDrainGrace is the time allowed for reading the remainder of a dump whose
+// context is done, see drainDump.
+const dumpDrainGrace = 100 * time.Millisecond
+
+// Dump sends nlm as a dump request and returns an iterator over the decoded
+// messages of the kernel's response, see DumpContext.
+func (c *Conn) Dump(nlm netlink.Message) iter.Seq2[Message, error] {
+	return c.DumpContext(context.Background(), nlm)
+}
+
+// DumpContext sends nlm as a dump request and returns an iterator over the
+// decoded messages of the kernel's response. The Request and Dump flags are set
+// on nlm. Unlike Query, the response is read from the socket and decoded one
+// datagram at a time as the loop progresses, so large tables are never resident
+// in memory as a whole. Cancelling ctx interrupts the dump, in which case the
+// iterator yields an *OpError wrapping ctx.Err() in place of the next message,
+// even if it was already read from the socket. Like QueryContext, cancellation
+// clears any deadline set using SetReadDeadline.
+//
+// If the kernel reports the dump was interrupted by a concurrent change, the
+// iterator yields an *OpError wrapping ErrDumpInterrupted in place of the first
+// affected message. The messages yielded before it are unaffected, but the dump
+// as a whole may be missing entries. Loop over the iterator again to restart the
+// dump.
+//
+// The iterator yields at most one error, after which it stops. When the loop
+// stops before the dump is complete, the remainder of the response is read and
+// discarded so the Conn can be used for further requests. Reading the remainder
+// is bounded by ctx, or by a short grace period if ctx is already done. If it
+// can't be read in time, the Conn becomes unusable and further requests fail
+// with ErrDumpNotDrained. The Conn can't be used for other requests while
+// iterating, doing so from within the loop body will block forever.
+func (c *Conn) DumpContext(ctx context.Context, nlm netlink.Message) iter.Seq2[Message, error] {
+	return func(yield func(Message, error) bool) {
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+
+		if err := c.checkUsable(); err != nil {
+			yield(Message{}, err)
+			return
+		}
+
+		c.reqMu.Lock()
+		defer c.reqMu.Unlock()
+		c.waitReader()
+
+		nlm.Header.Flags |= netlink.Request | netlink.Dump
+
+		trace(c.debug, "send", nlm)
+
+		req, err := c.conn.Send(nlm)
+		if err != nil {
+			yield(Message{}, requestError("dump", nlm, err))
+			return
+		}
+
+		for done := false; !done; {
+			var msgs []netlink.Message
+			msgs, done, err = c.readDump(ctx, req)
+
+			// Stop at the first message affected by an interruption.
+			for i, m := range msgs {
+				if m.Header.Flags&netlink.DumpInterrupted != 0 {
+					msgs, err = msgs[:i], &OpError{Op: "dump", Header: requestHeader(req), Err: ErrDumpInterrupted}
+					break
+				}
+			}
+
+			for _, m := range msgs {
+				if err := ctx.Err(); err != nil {
+					yield(Message{}, requestError("dump", req, err))
+					c.drainDump(ctx, req, done)
+					return
+				}
+
+				msg, err := UnmarshalMessage(m)
+				if !yield(msg, err) || err != nil {
+					c.drainDump(ctx, req, done)
+					return
+				}
+			}
+
+			if err != nil {
+				yield(Message{}, err)
+				c.drainDump(ctx, req, done)
+				return
+			}
+		}
+	}
+}
+
+// readDump reads a single datagram of the response to dump request req and
+// returns the messages it contains, omitting any messages not belonging to req.
+// done is true once the end of the response has been read, which is also the
+// case when the kernel reported an error. Messages preceding an error in the
+// same datagram are returned along with it.
+func (c *Conn) readDump(ctx context.Context, req netlink.Message) (msgs []netlink.Message, done bool, err error) {
+	var raw []netlink.Message
+	err = c.withContext(ctx, func() (err error) {
+		raw, err = c.receiveRaw()
+		return err
+	})
+	if err != nil {
+		return nil, false, requestError("dump", req, err)
+	}
+
+	trace(c.debug, "recv", raw...)
+
+	msgs = raw[:0]
+	for _, m := range raw {
+		if m.Header.Sequence != req.Header.Sequence {
+			continue
+		}
+
+		switch m.Header.Type {
+		case netlink.Error:
+			// Acknowledgements only terminate the response.
+			if err := ackError(m); err != nil {
+				return msgs, true, requestError("dump", req, err)
+			}
+			return msgs, true, nil
+		case netlink.Done:
+			if err := doneError(m); err != nil {
+				return msgs, true, requestError("dump", req, err)
+			}
+			// The flag may only be set on the Done message, when the change
+			// happened after the last data message was dumped.
+			if m.Header.Flags&netlink.DumpInterrupted != 0 {
+				return msgs, true, &OpError{Op: "dump", Header: requestHeader(req), Err: ErrDumpInterrupted}
+			}
+			return msgs, true, nil
+		}
+
+		msgs = append(msgs, m)
+
+		// Responses consisting of a single message aren't terminated.
+		if m.Header.Flags&netlink.Multi == 0 {
+			return msgs, true, nil
+		}
+	}
+
+	return msgs, false, nil
+}
+
+// drainDump reads and discards the remainder of the response to dump request
+// req, unless done indicates it has already been read completely. The drain is
+// bounded by ctx, or by dumpDrainGrace if ctx is already done. If the response
+// can't be read completely, the Conn is marked unusable, since the kernel would
+// continue the dump on its next read.
+func (c *Conn) drainDump(ctx context.Context, req netlink.Message, done bool) {
+	if done {
+		return
+	}
+
+	if ctx.Err() != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(context.WithoutCancel(ctx), dumpDrainGrace)
+		defer cancel()
+	}
+
+	for !done {
+		var err error
+		if _, done, err = c.readDump(ctx, req); err != nil && !done {
+			c.undrained.Store(true)
+			return
+		}
+	}
+}
@@ -0,0 +1,359 @@
+package netfilter
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mdlayher/netlink"
+	"github.com/mdlayher/netlink/nlenc"
+	"github.com/mdlayher/netlink/nltest"
+	"golang.org/x/sys/unix"
+)
+
+var dumpTestReq = netlink.Message{Data: []byte{0, 0, 0, 0}}
+
+// dumpTestConn returns a Conn answering dump requests with n messages carrying
+// their index as attribute 1, delivered in datagrams of per messages each. The
+// response is terminated by a Done message carrying errno, and can be altered
+// using editDump.
+func dumpTestConn(tb testing.TB, n, per int, errno unix.Errno) (*Conn, *[][]netlink.Message) {
+	tb.Helper()
+
+	var pending [][]netlink.Message
+
+	c := &Conn{conn: nltest.Dial(func(req []netlink.Message) ([]netlink.Message, error) {
+		if req[0].Header.Flags&netlink.Dump == 0 {
+			tb.Errorf("dump flag not set on request")
+		}
+		seq := req[0].Header.Sequence
+
+		var dg []netlink.Message
+		for i := range n {
+			m, err := MarshalNetlink(Header{SubsystemID: NFSubsysCTNetlink},
+				[]Attribute{{Type: 1, Data: Uint32Bytes(uint32(i))}})
+			if err != nil {
+				return nil, err
+			}
+			m.Header.Flags |= netlink.Multi
+			m.Header.Sequence = seq
+			dg = append(dg, m)
+
+			if len(dg) == per {
+				pending = append(pending, dg)
+				dg = nil
+			}
+		}
+
+		dg = append(dg, netlink.Message{
+			Header: netlink.Header{Type: netlink.Done, Flags: netlink.Multi, Sequence: seq},
+			Data:   nlenc.Int32Bytes(-int32(errno)),
+		})
+		pending = append(pending, dg)
+
+		return nil, nil
+	})}
+
+	c.recvRaw = func() ([]netlink.Message, error) {
+		if len(pending) == 0 {
+			return nil, errors.New("no pending datagrams")
+		}
+		dg := pending[0]
+		pending = pending[1:]
+		return dg, nil
+	}
+
+	return c, &pending
+}
+
+// editDump makes the Conn call fn with the index and contents of every
+// datagram it reads, returning its result instead.
+func editDump(c *Conn, fn func(i int, dg []netlink.Message) []netlink.Message) {
+	recv := c.recvRaw
+
+	var i int
+	c.recvRaw = func() ([]netlink.Message, error) {
+		dg, err := recv()
+		if err != nil {
+			return nil, err
+		}
+		dg = fn(i, dg)
+		i++
+		return dg, nil
+	}
+}
+
+// dumpIndices returns the indices carried by the messages of a dump, and the
+// first error the dump yields.
+func dumpIndices(seq func(func(Message, error) bool)) ([]uint32, error) {
+	var out []uint32
+	for m, err := range seq {
+		if err != nil {
+			return out, err
+		}
+		out = append(out, m.Attributes[0].Uint32())
+	}
+	return out, nil
+}
+
+func TestConnDump(t *testing.T) {
+	c, pending := dumpTestConn(t, 5, 2, 0)
+
+	got, err := dumpIndices(c.Dump(dumpTestReq))
+	require.NoError(t, err)
+	assert.Equal(t, []uint32{0, 1, 2, 3, 4}, got)
+	assert.Empty(t, *pending)
+
+	// Messages belonging to other requests are ignored.
+	c, pending = dumpTestConn(t, 2, 1, 0)
+	editDump(c, func(_ int, dg []netlink.Message) []netlink.Message {
+		foreign := netlink.Message{Header: netlink.Header{Type: netlink.Done, Sequence: 1 << 31}}
+		return append([]netlink.Message{foreign}, dg...)
+	})
+
+	got, err = dumpIndices(c.Dump(dumpTestReq))
+	require.NoError(t, err)
+	assert.Equal(t, []uint32{0, 1}, got)
+	assert.Empty(t, *pending)
+}
+
+func TestConnDumpBreak(t *testing.T) {
+	c, pending := dumpTestConn(t, 10, 3, 0)
+
+	var n int
+	for _, err := range c.Dump(dumpTestReq) {
+		require.NoError(t, err)
+		if n++; n == 4 {
+			break
+		}
+	}
+	assert.Equal(t, 4, n)
+
+	// The remainder of the response must have been drained.
+	assert.Empty(t, *pending)
+
+	got, err := dumpIndices(c.Dump(dumpTestReq))
+	require.NoError(t, err)
+	assert.Len(t, got, 10)
+}
+
+func TestConnDumpNotDrained(t *testing.T) {
+	c, _ := dumpTestConn(t, 10, 1, 0)
+
+	// The remainder of the dump can't be read in time.
+	recv := c.recvRaw
+	var reads int
+	c.recvRaw = func() ([]netlink.Message, error) {
+		if reads++; reads > 2 {
+			return nil, os.ErrDeadlineExceeded
+		}
+		return recv()
+	}
+
+	for range c.Dump(dumpTestReq) {
+		break
+	}
+
+	_, err := dumpIndices(c.Dump(dumpTestReq))
+	assert.ErrorIs(t, err, ErrDumpNotDrained)
+
+	_, err = c.Query(dumpTestReq)
+	assert.ErrorIs(t, err, ErrDumpNotDrained)
+}
+
+func TestConnDumpError(t *testing.T) {
+	// Error reported when the dump ends.
+	c, _ := dumpTestConn(t, 3, 2, unix.EINTR)
+
+	got, err := dumpIndices(c.Dump(dumpTestReq))
+	assert.Len(t, got, 3)
+
+	var oe *OpError
+	require.ErrorAs(t, err, &oe)
+	assert.Equal(t, "dump", oe.Op)
+	assert.ErrorIs(t, err, unix.EINTR)
+
+	// Error reported instead of a response, the remainder is not drained.
+	c, pending := dumpTestConn(t, 3, 2, 0)
+	editDump(c, func(_ int, dg []netlink.Message) []netlink.Message {
+		req := netlink.Message{Header: netlink.Header{Length: nlmsgHeaderLen, Sequence: dg[0].Header.Sequence}}
+		return []netlink.Message{errorMessage(req, unix.EPERM, "", 0)}
+	})
+
+	got, err = dumpIndices(c.Dump(dumpTestReq))
+	assert.Empty(t, got)
+	assert.ErrorIs(t, err, unix.EPERM)
+	assert.Len(t, *pending, 1)
+
+	// Undecodable messages stop the dump.
+	c, pending = dumpTestConn(t, 4, 2, 0)
+	editDump(c, func(i int, dg []netlink.Message) []netlink.Message {
+		if i == 0 {
+			dg[1].Data = []byte{0}
+		}
+		return dg
+	})
+
+	got, err = dumpIndices(c.Dump(dumpTestReq))
+	assert.Equal(t, []uint32{0}, got)
+	assert.ErrorIs(t, err, ErrMessageLen)
+	assert.Empty(t, *pending)
+
+	// Multicast Conns can't dump.
+	c.isMulticast = true
+	_, err = dumpIndices(c.Dump(dumpTestReq))
+	assert.ErrorIs(t, err, ErrConnIsMulticast)
+}
+
+func TestConnDumpInterrupted(t *testing.T) {
+	c, pending := dumpTestConn(t, 6, 2, 0)
+	editDump(c, func(i int, dg []netlink.Message) []netlink.Message {
+		// The kernel flags all messages following a change.
+		if i >= 1 {
+			for j := range dg {
+				dg[j].Header.Flags |= netlink.DumpInterrupted
+			}
+		}
+		return dg
+	})
+
+	got, err := dumpIndices(c.Dump(dumpTestReq))
+	assert.Equal(t, []uint32{0, 1}, got)
+
+	var oe *OpError
+	require.ErrorAs(t, err, &oe)
+	assert.Equal(t, "dump", oe.Op)
+	assert.ErrorIs(t, err, ErrDumpInterrupted)
+
+	// The remainder of the interrupted dump must have been drained.
+	assert.Empty(t, *pending)
+
+	// Only the Done message is flagged when the change happened after the last
+	// data message was dumped.
+	c, pending = dumpTestConn(t, 4, 2, 0)
+	editDump(c, func(_ int, dg []netlink.Message) []netlink.Message {
+		for j := range dg {
+			if dg[j].Header.Type == netlink.Done {
+				dg[j].Header.Flags |= netlink.DumpInterrupted
+			}
+		}
+		return dg
+	})
+
+	got, err = dumpIndices(c.Dump(dumpTestReq))
+	assert.Equal(t, []uint32{0, 1, 2, 3}, got)
+	assert.ErrorIs(t, err, ErrDumpInterrupted)
+	assert.Empty(t, *pending)
+}
+
+func TestConnDumpContext(t *testing.T) {
+	c, pending := dumpTestConn(t, 3, 1, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	got, err := dumpIndices(c.DumpContext(ctx, dumpTestReq))
+	assert.Empty(t, got)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Empty(t, *pending)
+
+	// Messages already read from the socket aren't yielded after cancellation.
+	c, pending = dumpTestConn(t, 3, 3, 0)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+
+	got = nil
+	for m, err := range c.DumpContext(ctx, dumpTestReq) {
+		if err != nil {
+			var oe *OpError
+			require.ErrorAs(t, err, &oe)
+			assert.Equal(t, "dump", oe.Op)
+			assert.ErrorIs(t, err, context.Canceled)
+			break
+		}
+		got = append(got, m.Attributes[0].Uint32())
+		cancel()
+	}
+	assert.Equal(t, []uint32{0}, got)
+	assert.Empty(t, *pending)
+}
+
+func TestConnDumpSocket(t *testing.T) {
+	c, err := Dial(nil)
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Dump the conntrack table of the current network namespace. This
+	// requires CAP_NET_ADMIN and the nf_conntrack module, but either way the
+	// response must be read from the socket completely.
+	req, err := MarshalNetlink(Header{SubsystemID: NFSubsysCTNetlink, MessageType: 1, Family: ProtoIPv4}, nil)
+	require.NoError(t, err)
+
+	_, err = dumpIndices(c.DumpContext(ctx, req))
+	if err != nil {
+		var errno unix.Errno
+		require.ErrorAs(t, err, &errno)
+	}
+
+	// The Conn must be usable for a second dump.
+	_, err2 := dumpIndices(c.DumpContext(ctx, req))
+	assert.Equal(t, err == nil, err2 == nil)
+}
+
+func BenchmarkConnDump(b *testing.B) {
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		c, _ := dumpTestConn(b, 1000, 20, 0)
+		b.StartTimer()
+
+		for _, err := range c.Dump(dumpTestReq) {
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkConnQueryDump(b *testing.B) {
+	b.ReportAllocs()
+
+	c := Conn{conn: nltest.Dial(func(req []netlink.Message) ([]netlink.Message, error) {
+		msgs := make([]netlink.Message, 0, 1001)
+		for i := range 1000 {
+			m, err := MarshalNetlink(Header{SubsystemID: NFSubsysCTNetlink},
+				[]Attribute{{Type: 1, Data: Uint32Bytes(uint32(i))}})
+			if err != nil {
+				return nil, err
+			}
+			m.Header.Sequence = req[0].Header.Sequence
+			msgs = append(msgs, m)
+		}
+		return nltest.Multipart(append(msgs, netlink.Message{Header: netlink.Header{Sequence: req[0].Header.Sequence}}))
+	})}
+
+	req := dumpTestReq
+	req.Header.Flags = netlink.Request | netlink.Dump
+
+	for i := 0; i < b.N; i++ {
+		msgs, err := c.Query(req)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for _, m := range msgs {
+			if _, err := UnmarshalMessage(m); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
@@ -18,6 +18,13 @@ const (
 	NFSubsysCount            // NFNL_SUBSYS_COUNT
 )
 
+// Message types of the messages framing an nfnetlink batch, see Batch. They are
+// sent with SubsystemID NFSubsysNone and the target subsystem as ResourceID.
+const (
+	NFNLMsgBatchBegin MessageType = 0x10 // NFNL_MSG_BATCH_BEGIN
+	NFNLMsgBatchEnd   MessageType = 0x11 // NFNL_MSG_BATCH_END
+)
+
 // ProtoFamily represents a protocol family in the Netfilter header (nfgenmsg).
 type ProtoFamily uint8
 
@@ -2,18 +2,190 @@ package netfilter
 
 import (
 	"errors"
+	"fmt"
+
+	"golang.org/x/sys/unix"
 )
 
 var (
-	// errInvalidAttributeFlags specifies if an Attribute's flag configuration is invalid.
-	// From a comment in Linux/include/uapi/linux/netlink.h, Nested and NetByteOrder are mutually exclusive.
-	errInvalidAttributeFlags = errors.New("invalid attribute; type cannot have both nested and net byte order flags")
+	// ErrInvalidAttributeFlags is returned when an Attribute has both the Nested
+	// and NetByteOrder flags set. From a comment in Linux/include/uapi/linux/netlink.h,
+	// Nested and NetByteOrder are mutually exclusive.
+	ErrInvalidAttributeFlags = errors.New("invalid attribute; type cannot have both nested and net byte order flags")
+
+	// ErrInvalidAttributeLength is returned when an attribute's length field
+	// doesn't fit its header or exceeds the remaining buffer.
+	ErrInvalidAttributeLength = errors.New("invalid attribute; length too short or too large")
+
+	// ErrAttributeTooLarge is returned when encoding an Attribute whose payload
+	// doesn't fit the 16-bit length field of a netlink attribute.
+	ErrAttributeTooLarge = errors.New("attribute is too large to fit in a netlink attribute")
+
+	// ErrMessageTooLarge is returned when encoding a message that doesn't fit
+	// the 32-bit length field of a netlink message.
+	ErrMessageTooLarge = errors.New("message is too large to fit in a netlink message")
+
+	// ErrMessageLen is returned when decoding a netlink message that is too
+	// short to hold a Netfilter header.
+	ErrMessageLen = errors.New("expected at least 4 bytes in netlink message payload")
+
+	// ErrConnIsMulticast is returned when sending a query on a Conn that is
+	// attached to one or more multicast groups.
+	ErrConnIsMulticast = errors.New("Conn attached to multicast group, leave all groups or re-dial for sending messages")
+
+	// ErrMulticastPending is returned when sending a query on a Conn that has
+	// left all multicast groups, but still has unread notifications pending.
+	// Read them using Receive before sending queries.
+	ErrMulticastPending = errors.New("Conn has unread multicast notifications, drain them before sending messages")
+
+	// ErrSubscribed is returned by Subscribe when the Conn already has an
+	// active subscription.
+	ErrSubscribed = errors.New("Conn already has an active subscription")
+
+	// ErrNoMulticastGroups is returned by JoinGroups when no groups are given.
+	ErrNoMulticastGroups = errors.New("need one or more multicast groups to join")
 
-	errMessageLen = errors.New("expected at least 4 bytes in netlink message payload")
+	// ErrDumpInterrupted is returned when the kernel's table changed while it
+	// was being dumped, meaning the dump may be missing entries or contain
+	// duplicates. The kernel signals this by setting netlink.DumpInterrupted
+	// (NLM_F_DUMP_INTR) on the messages of the dump.
+	ErrDumpInterrupted = errors.New("dump interrupted by a concurrent change, results may be inconsistent")
 
-	errConnIsMulticast = errors.New("Conn attached to multicast group, re-dial for sending messages")
+	// ErrDumpNotDrained is returned when sending a request on a Conn whose
+	// last dump was stopped early and the remainder of its response couldn't
+	// be read. The kernel would continue the dump on the next read, so the
+	// Conn is unusable.
+	ErrDumpNotDrained = errors.New("Conn has an unfinished dump, re-dial for sending messages")
 
-	errNoMulticastGroups = errors.New("need one or more multicast groups to join")
+	// ErrNilAttributeEncoder is returned by EncodeNetlink when given a nil
+	// AttributeEncoder.
+	ErrNilAttributeEncoder = errors.New("given AttributeEncoder is nil")
+)
+
+var (
+	// ErrAttributeNested is returned by an accessor when an Attribute holds
+	// nested attributes instead of a scalar payload.
+	ErrAttributeNested = errors.New("unexpected nested attribute")
+
+	// ErrAttributeLength is returned by an accessor when the length of an
+	// Attribute's payload does not match the size of the requested type.
+	ErrAttributeLength = errors.New("unexpected attribute length")
+
+	// ErrAttributeMissing is returned by Policy validation when a required
+	// attribute is absent.
+	ErrAttributeMissing = errors.New("required attribute missing")
 
-	errNilAttributeEncoder = errors.New("given AttributeEncoder is nil")
+	// ErrAttributeNotNested is returned by Policy validation when nested
+	// attributes are expected, but the attribute holds a plain payload.
+	ErrAttributeNotNested = errors.New("expected nested attribute")
 )
+
+// An AttributeError is returned when an Attribute's payload cannot be
+// interpreted as the type requested by an accessor. Err is one of
+// ErrAttributeNested or ErrAttributeLength.
+type AttributeError struct {
+	// Name of the accessor that failed, eg. "Uint16".
+	Op string
+
+	// Type and payload length of the offending Attribute.
+	Type   uint16
+	Length int
+
+	Err error
+}
+
+func (e *AttributeError) Error() string {
+	return fmt.Sprintf("%s: attribute type %d, length %d: %v", e.Op, e.Type, e.Length, e.Err)
+}
+
+// Unwrap returns the underlying error, for use with errors.Is and errors.As.
+func (e *AttributeError) Unwrap() error {
+	return e.Err
+}
+
+// A DecodeError is returned when a netlink message or a list of attributes is
+// malformed and cannot be decoded.
+type DecodeError struct {
+	// Offset of the malformed attribute (or header) in bytes. For netlink
+	// messages, it is relative to the start of the message's Data, which
+	// includes the Netfilter header. Otherwise, it is relative to the start of
+	// the buffer being decoded.
+	Offset int
+
+	// Types of the attributes leading up to the failure, starting at the top
+	// level. If the offending attribute's header could not be decoded, Path
+	// ends with the type of the enclosing attribute.
+	Path []uint16
+
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	if len(e.Path) == 0 {
+		return fmt.Sprintf("decoding netfilter message at offset %d: %v", e.Offset, e.Err)
+	}
+
+	return fmt.Sprintf("decoding netfilter message at offset %d, attribute %s: %v",
+		e.Offset, formatPath(e.Path), e.Err)
+}
+
+// Unwrap returns the underlying error, for use with errors.Is and errors.As.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// An OpError is returned by Conn when an operation on the underlying netlink
+// socket fails. Err typically is a *netlink.OpError, so errors.Is can be used
+// to check for kernel error numbers like unix.ENOENT.
+type OpError struct {
+	// Operation that failed, eg. "query".
+	Op string
+
+	// Header of the request that was sent, if any.
+	Header Header
+
+	// Extended acknowledgement sent by the kernel when rejecting a request.
+	// Message is a human-readable description of the error and Offset the
+	// offset in bytes of the offending part of the request, relative to the
+	// start of its netlink header. Both are zero if not provided.
+	Message string
+	Offset  int
+
+	// Types of the attributes leading up to and including the request
+	// attribute pointed to by Offset, starting at the top level. Nil if the
+	// kernel didn't point to an attribute.
+	Path []uint16
+
+	Err error
+}
+
+func (e *OpError) Error() string {
+	if len(e.Path) != 0 {
+		return fmt.Sprintf("netfilter %s: attribute %s: %v", e.Op, formatPath(e.Path), e.Err)
+	}
+
+	return fmt.Sprintf("netfilter %s: %v", e.Op, e.Err)
+}
+
+// Unwrap returns the underlying error, for use with errors.Is and errors.As.
+func (e *OpError) Unwrap() error {
+	return e.Err
+}
+
+// An OverrunError is sent by Subscribe when the socket's receive buffer
+// overflowed and the kernel dropped one or more events (ENOBUFS). The state
+// built from the event stream is stale from this point on, see Watch.
+type OverrunError struct {
+	// Amount of overruns since the subscription started, including this one.
+	// The kernel doesn't report how many events were dropped by each overrun.
+	Count int
+}
+
+func (e *OverrunError) Error() string {
+	return fmt.Sprintf("netfilter receive: socket receive buffer overrun, events lost (%d overruns)", e.Count)
+}
+
+// Unwrap returns unix.ENOBUFS, for use with errors.Is.
+func (e *OverrunError) Unwrap() error {
+	return unix.ENOBUFS
+}
@@ -0,0 +1,224 @@
+package netfilter
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/mdlayher/netlink"
+)
+
+// A NameTable holds the symbolic names of a subsystem's message types and
+// attributes, used by Format and Fprint to render messages in a readable way.
+// Subsystem packages register their NameTable using RegisterNames.
+type NameTable struct {
+	// Names of the subsystem's message types, e.g. IPCTNL_MSG_CT_NEW.
+	MessageTypes map[MessageType]string
+
+	// Names of the top-level attributes of all of the subsystem's messages.
+	Attributes AttributeNames
+
+	// Names of the top-level attributes of specific message types, taking
+	// precedence over Attributes.
+	MessageAttributes map[MessageType]AttributeNames
+}
+
+// attributes returns the AttributeNames for messages of type mt.
+func (t NameTable) attributes(mt MessageType) AttributeNames {
+	if names, ok := t.MessageAttributes[mt]; ok {
+		return names
+	}
+
+	return t.Attributes
+}
+
+// AttributeNames maps attribute types to their AttributeName.
+type AttributeNames map[uint16]AttributeName
+
+// An AttributeName describes how to render a single attribute type.
+type AttributeName struct {
+	// Symbolic name of the attribute type, e.g. CTA_TUPLE_ORIG.
+	Name string
+
+	// Kind of the attribute's payload, used to decode its value. Attributes
+	// of KindNested are rendered as nested attributes, even if their Nested
+	// flag is not set. Payloads of other kinds are rendered as hex.
+	Kind AttributeKind
+
+	// Optional function rendering the attribute's value, overriding Kind.
+	Format func(Attribute) string
+
+	// Names of the attribute's children, if it is a nested attribute.
+	Children AttributeNames
+}
+
+var nameTables = struct {
+	sync.RWMutex
+	m map[SubsystemID]NameTable
+}{m: make(map[SubsystemID]NameTable)}
+
+// RegisterNames registers the NameTable for subsystem subsys, replacing any
+// previous registration. It is typically called from the init function of a
+// subsystem package.
+func RegisterNames(subsys SubsystemID, t NameTable) {
+	nameTables.Lock()
+	defer nameTables.Unlock()
+
+	nameTables.m[subsys] = t
+}
+
+// lookupNames returns the NameTable registered for subsys, if any.
+func lookupNames(subsys SubsystemID) NameTable {
+	nameTables.RLock()
+	defer nameTables.RUnlock()
+
+	return nameTables.m[subsys]
+}
+
+// Format renders a Netfilter message as an indented tree, using the names
+// registered for the Header's subsystem. The first line describes the Header,
+// followed by one line per attribute:
+//
+//	NFSubsysCTNetlink IPCTNL_MSG_CT_NEW family=ProtoIPv4 version=0 resource=0 flags=0
+//	  CTA_TUPLE_ORIG (1):
+//	    CTA_TUPLE_IP (1):
+//	      CTA_IP_V4_SRC (1): 0a 00 00 01
+//	  CTA_STATUS (3): 392
+//
+// Attributes without a registered name are shown by their type number.
+func Format(h Header, attrs []Attribute) string {
+	var b strings.Builder
+	_ = Fprint(&b, h, attrs)
+	return b.String()
+}
+
+// Fprint writes the output of Format for the given Header and Attributes to w.
+func Fprint(w io.Writer, h Header, attrs []Attribute) error {
+	names := lookupNames(h.SubsystemID)
+
+	var b bytes.Buffer
+	b.WriteString(formatHeader(names, h))
+	b.WriteByte('\n')
+	formatAttributes(&b, names.attributes(h.MessageType), attrs, 1)
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// FprintNetlink decodes msg and writes it to w like Fprint. Netlink control
+// messages and messages that cannot be decoded are described on a single line.
+func FprintNetlink(w io.Writer, msg netlink.Message) error {
+	if msg.Header.Type < netlink.HeaderType(nlmsgMinType) {
+		_, err := fmt.Fprintf(w, "%s flags=%s seq=%d len=%d\n",
+			msg.Header.Type, msg.Header.Flags, msg.Header.Sequence, len(msg.Data))
+		return err
+	}
+
+	h, attrs, err := UnmarshalNetlink(msg)
+	if err != nil {
+		_, err := fmt.Fprintf(w, "undecodable message type %#x: %v\n", uint16(msg.Header.Type), err)
+		return err
+	}
+
+	return Fprint(w, h, attrs)
+}
+
+// Netlink message types below NLMSG_MIN_TYPE are reserved for control messages.
+const nlmsgMinType = 0x10
+
+// formatHeader renders h on a single line.
+func formatHeader(names NameTable, h Header) string {
+	mt, ok := names.MessageTypes[h.MessageType]
+	if !ok {
+		mt = fmt.Sprintf("type %d", h.MessageType)
+	}
+
+	return fmt.Sprintf("%s %s family=%s version=%d resource=%d flags=%s",
+		h.SubsystemID, mt, h.Family, h.Version, h.ResourceID, h.Flags)
+}
+
+// formatAttributes writes attrs to b, one per line, indented by depth levels.
+func formatAttributes(b *bytes.Buffer, names AttributeNames, attrs []Attribute, depth int) {
+	for _, a := range attrs {
+		n, known := names[a.Type]
+
+		b.WriteString(strings.Repeat("  ", depth))
+		if known && n.Name != "" {
+			fmt.Fprintf(b, "%s (%d)", n.Name, a.Type)
+		} else {
+			fmt.Fprintf(b, "%d", a.Type)
+		}
+		if a.NetByteOrder {
+			b.WriteString(" [netbyteorder]")
+		}
+		b.WriteByte(':')
+
+		children, nested := a.Children, a.hasChildren()
+		if !nested && known && n.Kind == KindNested && n.Format == nil {
+			// The kernel may omit the Nested flag, try decoding the payload.
+			if c, err := UnmarshalAttributes(a.Data); err == nil {
+				children, nested = c, true
+			}
+		}
+
+		if nested {
+			b.WriteByte('\n')
+			formatAttributes(b, n.Children, children, depth+1)
+			continue
+		}
+
+		b.WriteByte(' ')
+		b.WriteString(formatValue(n, a))
+		b.WriteByte('\n')
+	}
+}
+
+// formatValue renders the payload of a non-nested Attribute according to n.
+func formatValue(n AttributeName, a Attribute) string {
+	if n.Format != nil {
+		return n.Format(a)
+	}
+
+	var (
+		v   any
+		err error
+	)
+
+	switch n.Kind {
+	case KindU8:
+		if err = checkScalar("Uint8", a.Type, a.Nested, a.Data, 1); err == nil {
+			v = a.Data[0]
+		}
+	case KindU16:
+		v, err = a.ParseUint16()
+	case KindU32:
+		v, err = a.ParseUint32()
+	case KindU64:
+		v, err = a.ParseUint64()
+	case KindString:
+		var s string
+		if s, err = a.ParseString(); err == nil {
+			v = fmt.Sprintf("%q", s)
+		}
+	default:
+		return formatBytes(a.Data)
+	}
+
+	// Fall back to hex if the payload doesn't match the expected kind.
+	if err != nil {
+		return formatBytes(a.Data)
+	}
+
+	return fmt.Sprint(v)
+}
+
+// formatBytes renders b as space-separated hex bytes.
+func formatBytes(b []byte) string {
+	if len(b) == 0 {
+		return "(empty)"
+	}
+
+	return fmt.Sprintf("% x", b)
+}
@@ -0,0 +1,101 @@
+package netfilter
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mdlayher/netlink"
+)
+
+var formatTestNames = NameTable{
+	MessageTypes: map[MessageType]string{
+		0: "IPCTNL_MSG_CT_NEW",
+	},
+	Attributes: AttributeNames{
+		1: {Name: "CTA_TUPLE_ORIG", Kind: KindNested, Children: AttributeNames{
+			1: {Name: "CTA_TUPLE_IP", Kind: KindNested, Children: AttributeNames{
+				1: {Name: "CTA_IP_V4_SRC", Format: func(a Attribute) string {
+					addr, _ := a.ParseAddr()
+					return addr.String()
+				}},
+			}},
+		}},
+		3:  {Name: "CTA_STATUS", Kind: KindU32},
+		5:  {Name: "CTA_HELP", Kind: KindNested, Children: AttributeNames{1: {Name: "CTA_HELP_NAME", Kind: KindString}}},
+		7:  {Name: "CTA_TIMEOUT", Kind: KindU32},
+		18: {Name: "CTA_ZONE", Kind: KindU16},
+	},
+	MessageAttributes: map[MessageType]AttributeNames{
+		2: {1: {Name: "CTA_OTHER"}},
+	},
+}
+
+func TestFormat(t *testing.T) {
+	RegisterNames(NFSubsysCTNetlink, formatTestNames)
+	t.Cleanup(func() { RegisterNames(NFSubsysCTNetlink, NameTable{}) })
+
+	help, err := MarshalAttributes([]Attribute{{Type: 1, Data: []byte("ftp\x00")}})
+	require.NoError(t, err)
+
+	h := Header{SubsystemID: NFSubsysCTNetlink, Family: ProtoIPv4}
+	attrs := []Attribute{
+		{Type: 1, Nested: true, Children: []Attribute{
+			{Type: 1, Nested: true, Children: []Attribute{
+				{Type: 1, Data: []byte{10, 0, 0, 1}},
+				{Type: 2, Data: []byte{10, 0, 0, 2}},
+			}},
+		}},
+		{Type: 3, Data: Uint32Bytes(392)},
+		// Nested payload without the Nested flag.
+		{Type: 5, Data: help},
+		// Payload too short for its kind.
+		{Type: 7, Data: []byte{1, 2}},
+		{Type: 18, NetByteOrder: true, Data: Uint16Bytes(1)},
+		{Type: 30},
+	}
+
+	want := `NFSubsysCTNetlink IPCTNL_MSG_CT_NEW family=ProtoIPv4 version=0 resource=0 flags=0
+  CTA_TUPLE_ORIG (1):
+    CTA_TUPLE_IP (1):
+      CTA_IP_V4_SRC (1): 10.0.0.1
+      2: 0a 00 00 02
+  CTA_STATUS (3): 392
+  CTA_HELP (5):
+    CTA_HELP_NAME (1): "ftp"
+  CTA_TIMEOUT (7): 01 02
+  CTA_ZONE (18) [netbyteorder]: 1
+  30: (empty)
+`
+	assert.Equal(t, want, Format(h, attrs))
+
+	// Per-message type attribute names and unknown message types.
+	h.MessageType = 2
+	assert.Equal(t, "NFSubsysCTNetlink type 2 family=ProtoIPv4 version=0 resource=0 flags=0\n  CTA_OTHER (1): (empty)\n",
+		Format(h, []Attribute{{Type: 1}}))
+
+	// Unregistered subsystem.
+	h.SubsystemID = NFSubsysQueue
+	assert.Equal(t, "NFSubsysQueue type 2 family=ProtoIPv4 version=0 resource=0 flags=0\n  3: 00 00 01 88\n",
+		Format(h, []Attribute{{Type: 3, Data: Uint32Bytes(392)}}))
+}
+
+func TestFprintNetlink(t *testing.T) {
+	var b bytes.Buffer
+
+	msg, err := MarshalNetlink(Header{SubsystemID: NFSubsysQueue}, []Attribute{{Type: 1, Data: []byte{1}}})
+	require.NoError(t, err)
+	require.NoError(t, FprintNetlink(&b, msg))
+	assert.Equal(t, "NFSubsysQueue type 0 family=ProtoUnspec version=0 resource=0 flags=0\n  1: 01\n", b.String())
+
+	b.Reset()
+	done := netlink.Message{Header: netlink.Header{Type: netlink.Done, Sequence: 1}, Data: []byte{0, 0, 0, 0}}
+	require.NoError(t, FprintNetlink(&b, done))
+	assert.Equal(t, "done flags=0 seq=1 len=4\n", b.String())
+
+	b.Reset()
+	require.NoError(t, FprintNetlink(&b, netlink.Message{Header: netlink.Header{Type: 0x100}}))
+	assert.Contains(t, b.String(), "undecodable message type 0x100")
+}
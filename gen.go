@@ -2,3 +2,4 @@ package netfilter
 
 //go:generate stringer -type=ProtoFamily
 //go:generate stringer -type=SubsystemID
+//go:generate stringer -type=NetlinkGroup
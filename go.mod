@@ -6,7 +6,6 @@ toolchain go1.24.2
 
 require (
 	github.com/mdlayher/netlink v1.7.2
-	github.com/pkg/errors v0.9.1
 	github.com/stretchr/testify v1.8.4
 	golang.org/x/sys v0.33.0
 )
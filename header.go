@@ -38,16 +38,16 @@ func (h Header) String() string {
 // ResourceID is a generic field specific to the upper layer protocol (eg. CPU ID of Conntrack stats)
 type Header struct {
 	// Netlink header flags, to (un)marshal to a netlink Message in a single operation
-	Flags netlink.HeaderFlags
+	Flags netlink.HeaderFlags `json:"flags"`
 
 	// netlink Header Type
-	SubsystemID SubsystemID
-	MessageType MessageType
+	SubsystemID SubsystemID `json:"subsystem"`
+	MessageType MessageType `json:"message_type"`
 
 	// nfgenmsg
-	Family     ProtoFamily
-	Version    uint8 // Usually NFNETLINK_V0 (Go: NFNLv0)
-	ResourceID uint16
+	Family     ProtoFamily `json:"family"`
+	Version    uint8       `json:"version"` // Usually NFNETLINK_V0 (Go: NFNLv0)
+	ResourceID uint16      `json:"resource_id"`
 }
 
 // Size of a Netfilter header (nfgenmsg - 4 bytes)
@@ -55,16 +55,17 @@ const nfHeaderLen = 4
 
 // unmarshal unmarshals a netlink.Message into a Header. The message Data must be at least 4 bytes long.
 // The first 4 bytes of the message's Data field and the message's Header Type/Flags are used.
+// If Data is too short, only the fields taken from the netlink Header are set.
 func (h *Header) unmarshal(nlm netlink.Message) error {
-	if len(nlm.Data) < nfHeaderLen {
-		return errMessageLen
-	}
-
 	h.Flags = nlm.Header.Flags
 
 	h.SubsystemID = SubsystemID(uint16(nlm.Header.Type) & 0xff00 >> 8)
 	h.MessageType = MessageType(uint16(nlm.Header.Type) & 0x00ff)
 
+	if len(nlm.Data) < nfHeaderLen {
+		return ErrMessageLen
+	}
+
 	h.Family = ProtoFamily(nlm.Data[0])
 	h.Version = nlm.Data[1]
 	h.ResourceID = binary.BigEndian.Uint16(nlm.Data[2:4])
@@ -76,7 +77,7 @@ func (h *Header) unmarshal(nlm netlink.Message) error {
 // The Header Type and the first 4 bytes of the Data field are overwritten.
 func (h Header) marshal(nlm *netlink.Message) error {
 	if len(nlm.Data) < nfHeaderLen {
-		return errMessageLen
+		return ErrMessageLen
 	}
 
 	nlm.Header.Flags = h.Flags
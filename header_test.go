@@ -29,10 +29,10 @@ func TestHeaderMarshalTwoWay(t *testing.T) {
 	assert.Equal(t, refMsg, gotMsg, "unexpected marshal")
 
 	// unmarshal error
-	assert.Equal(t, errMessageLen, gotHdr.unmarshal(netlink.Message{}))
+	assert.Equal(t, ErrMessageLen, gotHdr.unmarshal(netlink.Message{}))
 
 	// marshal error
-	assert.Equal(t, errMessageLen, gotHdr.marshal(&netlink.Message{}))
+	assert.Equal(t, ErrMessageLen, gotHdr.marshal(&netlink.Message{}))
 }
 
 func TestHeaderString(t *testing.T) {
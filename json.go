@@ -0,0 +1,164 @@
+package netfilter
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// attributeJSON is the JSON representation of an Attribute. Data is omitted
+// for attributes with children, since it is derived from them when encoding.
+// Children is a pointer to distinguish attributes without children from
+// attributes with an empty list of children.
+type attributeJSON struct {
+	Type         uint16       `json:"type"`
+	Nested       bool         `json:"nested,omitempty"`
+	NetByteOrder bool         `json:"netbyteorder,omitempty"`
+	Data         *string      `json:"data,omitempty"`
+	Children     *[]Attribute `json:"children,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler. The payload of non-nested attributes
+// is encoded as a hex string, nested attributes list their children instead:
+//
+//	{"type":1,"nested":true,"children":[{"type":3,"data":"0a000001"}]}
+//
+// Unmarshaling the result using UnmarshalJSON yields an Attribute that encodes
+// to the same bytes.
+func (a Attribute) MarshalJSON() ([]byte, error) {
+	aj := attributeJSON{
+		Type:         a.Type,
+		Nested:       a.Nested,
+		NetByteOrder: a.NetByteOrder,
+	}
+
+	if a.hasChildren() {
+		children := a.Children
+		if children == nil {
+			children = []Attribute{}
+		}
+		aj.Children = &children
+	} else {
+		data := hex.EncodeToString(a.Data)
+		aj.Data = &data
+	}
+
+	return json.Marshal(aj)
+}
+
+// UnmarshalJSON implements json.Unmarshaler, see MarshalJSON for the format.
+func (a *Attribute) UnmarshalJSON(b []byte) error {
+	var aj attributeJSON
+	if err := json.Unmarshal(b, &aj); err != nil {
+		return err
+	}
+
+	if aj.Type&^nlaTypeMask != 0 {
+		return fmt.Errorf("attribute type %#x: invalid type", aj.Type)
+	}
+	if aj.Nested && aj.NetByteOrder {
+		return fmt.Errorf("attribute type %d: %w", aj.Type, ErrInvalidAttributeFlags)
+	}
+	if aj.Data != nil && aj.Children != nil {
+		return fmt.Errorf("attribute type %d: both data and children are set", aj.Type)
+	}
+
+	*a = Attribute{
+		Type:         aj.Type,
+		Nested:       aj.Nested,
+		NetByteOrder: aj.NetByteOrder,
+	}
+
+	if aj.Children != nil {
+		a.Children = *aj.Children
+		return nil
+	}
+
+	if aj.Nested {
+		a.Children = []Attribute{}
+		return nil
+	}
+
+	if aj.Data != nil {
+		data, err := hex.DecodeString(*aj.Data)
+		if err != nil {
+			return fmt.Errorf("attribute type %d: %w", aj.Type, err)
+		}
+		a.Data = data
+	}
+
+	return nil
+}
+
+// MarshalText implements encoding.TextMarshaler. Known subsystems are encoded
+// by name, e.g. NFSubsysCTNetlink, others as a decimal number.
+func (s SubsystemID) MarshalText() ([]byte, error) {
+	return marshalEnum(s), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, accepting names and
+// decimal numbers.
+func (s *SubsystemID) UnmarshalText(b []byte) error {
+	return unmarshalEnum(s, b)
+}
+
+// MarshalText implements encoding.TextMarshaler. Known protocol families are
+// encoded by name, e.g. ProtoIPv4, others as a decimal number.
+func (p ProtoFamily) MarshalText() ([]byte, error) {
+	return marshalEnum(p), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, accepting names and
+// decimal numbers.
+func (p *ProtoFamily) UnmarshalText(b []byte) error {
+	return unmarshalEnum(p, b)
+}
+
+// MarshalText implements encoding.TextMarshaler. Known multicast groups are
+// encoded by name, e.g. GroupCTNew, others as a decimal number.
+func (g NetlinkGroup) MarshalText() ([]byte, error) {
+	return marshalEnum(g), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, accepting names and
+// decimal numbers.
+func (g *NetlinkGroup) UnmarshalText(b []byte) error {
+	return unmarshalEnum(g, b)
+}
+
+// enum is implemented by the package's stringer-generated enum types.
+type enum interface {
+	~uint8
+	String() string
+}
+
+// marshalEnum returns the name of v, or its decimal value if v is unknown.
+func marshalEnum[T enum](v T) []byte {
+	// Stringer renders unknown values as 'Type(123)'.
+	if s := v.String(); !strings.HasSuffix(s, ")") {
+		return []byte(s)
+	}
+
+	return strconv.AppendUint(nil, uint64(v), 10)
+}
+
+// unmarshalEnum parses a name or decimal value of T from b into v.
+func unmarshalEnum[T enum](v *T, b []byte) error {
+	s := string(b)
+
+	if n, err := strconv.ParseUint(s, 10, 8); err == nil {
+		*v = T(n)
+		return nil
+	}
+
+	for i := 0; i <= 0xff; i++ {
+		if T(i).String() == s {
+			*v = T(i)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown %T %q", *v, s)
+}
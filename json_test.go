@@ -0,0 +1,145 @@
+package netfilter
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mdlayher/netlink"
+)
+
+func TestAttributeJSON(t *testing.T) {
+	attrs := []Attribute{
+		{Type: 1, Nested: true, Data: []byte{0xff}, Children: []Attribute{
+			{Type: 1, Data: []byte{10, 0, 0, 1}},
+			{Type: 2, Nested: true},
+		}},
+		{Type: 2, NetByteOrder: true, Data: Uint16Bytes(1)},
+		{Type: 3},
+		// Nested payload without the Nested flag, see NestingSchema.
+		{Type: 4, Children: []Attribute{{Type: 1, Data: []byte{1}}}},
+		{Type: 5, Children: []Attribute{}},
+	}
+
+	b, err := json.Marshal(attrs)
+	require.NoError(t, err)
+
+	want := `[{"type":1,"nested":true,"children":[{"type":1,"data":"0a000001"},{"type":2,"nested":true,"children":[]}]},` +
+		`{"type":2,"netbyteorder":true,"data":"0001"},{"type":3,"data":""},` +
+		`{"type":4,"children":[{"type":1,"data":"01"}]},{"type":5,"children":[]}]`
+	assert.JSONEq(t, want, string(b))
+
+	var out []Attribute
+	require.NoError(t, json.Unmarshal(b, &out))
+
+	assert.True(t, Equal(attrs, out))
+
+	wantBytes, err := MarshalAttributes(attrs)
+	require.NoError(t, err)
+	gotBytes, err := MarshalAttributes(out)
+	require.NoError(t, err)
+	assert.Equal(t, wantBytes, gotBytes)
+}
+
+func TestAttributeJSONErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+	}{
+		{name: "syntax", json: `{"type":`},
+		{name: "invalid type", json: `{"type":16385}`},
+		{name: "both flags", json: `{"type":1,"nested":true,"netbyteorder":true}`},
+		{name: "data and children", json: `{"type":1,"data":"00","children":[]}`},
+		{name: "invalid hex", json: `{"type":1,"data":"zz"}`},
+		{name: "invalid child", json: `{"type":1,"nested":true,"children":[{"type":1,"data":"0"}]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var a Attribute
+			assert.Error(t, json.Unmarshal([]byte(tt.json), &a))
+		})
+	}
+}
+
+func TestNetlinkJSONRoundTrip(t *testing.T) {
+	type message struct {
+		Header     Header      `json:"header"`
+		Attributes []Attribute `json:"attributes"`
+	}
+
+	h := Header{
+		Flags:       netlink.Request | netlink.Acknowledge,
+		SubsystemID: NFSubsysCTNetlink,
+		MessageType: 1,
+		Family:      ProtoIPv6,
+		ResourceID:  0x1234,
+	}
+	attrs := pathTestTree()
+
+	want, err := MarshalNetlink(h, attrs)
+	require.NoError(t, err)
+
+	b, err := json.Marshal(message{h, attrs})
+	require.NoError(t, err)
+	assert.Contains(t, string(b), `"subsystem":"NFSubsysCTNetlink"`)
+	assert.Contains(t, string(b), `"family":"ProtoIPv6"`)
+
+	var m message
+	require.NoError(t, json.Unmarshal(b, &m))
+	assert.Equal(t, h, m.Header)
+
+	got, err := MarshalNetlink(m.Header, m.Attributes)
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+}
+
+func TestEnumText(t *testing.T) {
+	tests := []struct {
+		v    any
+		text string
+	}{
+		{v: NFSubsysIPSet, text: "NFSubsysIPSet"},
+		{v: SubsystemID(200), text: "200"},
+		{v: ProtoBridge, text: "ProtoBridge"},
+		{v: ProtoFamily(4), text: "4"},
+		{v: GroupCTExpNew, text: "GroupCTExpNew"},
+		{v: NetlinkGroup(42), text: "42"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			b, err := json.Marshal(tt.v)
+			require.NoError(t, err)
+			assert.Equal(t, `"`+tt.text+`"`, string(b))
+
+			var err2 error
+			switch v := tt.v.(type) {
+			case SubsystemID:
+				var out SubsystemID
+				err2 = json.Unmarshal(b, &out)
+				assert.Equal(t, v, out)
+			case ProtoFamily:
+				var out ProtoFamily
+				err2 = json.Unmarshal(b, &out)
+				assert.Equal(t, v, out)
+			case NetlinkGroup:
+				var out NetlinkGroup
+				err2 = json.Unmarshal(b, &out)
+				assert.Equal(t, v, out)
+			}
+			require.NoError(t, err2)
+		})
+	}
+
+	var s SubsystemID
+	assert.EqualError(t, s.UnmarshalText([]byte("NFSubsysFoo")), `unknown netfilter.SubsystemID "NFSubsysFoo"`)
+	assert.Error(t, s.UnmarshalText([]byte("256")))
+
+	var g NetlinkGroup
+	require.NoError(t, g.UnmarshalText([]byte("GroupNFTrace")))
+	assert.Equal(t, GroupNFTrace, g)
+	assert.Equal(t, "NetlinkGroup(10)", NetlinkGroup(10).String())
+}
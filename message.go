@@ -1,19 +1,28 @@
 package netfilter
 
 import (
-	"github.com/pkg/errors"
+	"bytes"
+	"math"
+	"slices"
 
 	"github.com/mdlayher/netlink"
+	"github.com/mdlayher/netlink/nlenc"
 )
 
 // UnmarshalNetlink unmarshals a netlink.Message into a Netfilter Header and Attributes.
+// Attributes are decoded according to the NestingSchema registered for the
+// message's subsystem and message type, if any.
+//
+// Malformed messages result in a *DecodeError, with offsets relative to the
+// start of msg.Data.
 func UnmarshalNetlink(msg netlink.Message) (Header, []Attribute, error) {
-	h, ad, err := DecodeNetlink(msg)
-	if err != nil {
-		return Header{}, nil, err
+	var h Header
+	if err := h.unmarshal(msg); err != nil {
+		return Header{}, nil, &DecodeError{Err: err}
 	}
 
-	attrs, err := decodeAttributes(ad)
+	schema := lookupNestingSchema(h.SubsystemID, h.MessageType)
+	attrs, err := decodeAttributes(msg.Data[nfHeaderLen:], nfHeaderLen, nil, schema)
 	if err != nil {
 		return Header{}, nil, err
 	}
@@ -23,16 +32,23 @@ func UnmarshalNetlink(msg netlink.Message) (Header, []Attribute, error) {
 
 // DecodeNetlink returns msg's Netfilter header and an AttributeDecoder that can be used
 // to iteratively decode all Netlink attributes contained in the message.
+//
+// A message with a malformed header or top-level attribute list results in a
+// *DecodeError, with offsets relative to the start of msg.Data.
 func DecodeNetlink(msg netlink.Message) (Header, *netlink.AttributeDecoder, error) {
 	var h Header
-	err := h.unmarshal(msg)
-	if err != nil {
-		return Header{}, nil, errors.Wrap(err, "unmarshaling netfilter header")
+	if err := h.unmarshal(msg); err != nil {
+		return Header{}, nil, &DecodeError{Err: err}
 	}
 
-	ad, err := NewAttributeDecoder(msg.Data[nfHeaderLen:])
+	b := msg.Data[nfHeaderLen:]
+	ad, err := NewAttributeDecoder(b)
 	if err != nil {
-		return Header{}, nil, errors.Wrap(err, "creating attribute decoder")
+		// Locate the malformed attribute, the AttributeDecoder doesn't expose it.
+		it := NewAttributeIterator(b)
+		for it.Next() {
+		}
+		return Header{}, nil, &DecodeError{Offset: nfHeaderLen + it.Offset(), Err: err}
 	}
 
 	return h, ad, nil
@@ -40,19 +56,25 @@ func DecodeNetlink(msg netlink.Message) (Header, *netlink.AttributeDecoder, erro
 
 // MarshalNetlink takes a Netfilter Header and Attributes and returns a netlink.Message.
 func MarshalNetlink(h Header, attrs []Attribute) (netlink.Message, error) {
-	ae := NewAttributeEncoder()
-	if err := encodeAttributes(ae, attrs); err != nil {
+	// Allocate space for the netfilter header and all attributes at once.
+	b, err := AppendAttributes(make([]byte, nfHeaderLen, nfHeaderLen+attributesLen(attrs)), attrs)
+	if err != nil {
 		return netlink.Message{}, err
 	}
 
-	return EncodeNetlink(h, ae)
+	nlm := netlink.Message{Data: b}
+
+	// marshal error ignored, safe to do if msg Data is initialized.
+	_ = h.marshal(&nlm)
+
+	return nlm, nil
 }
 
 // EncodeNetlink generates a netlink.Message based on a given netfilter header h
 // and a pre-filled netlink.AttributeEncoder ae.
 func EncodeNetlink(h Header, ae *netlink.AttributeEncoder) (netlink.Message, error) {
 	if ae == nil {
-		return netlink.Message{}, errNilAttributeEncoder
+		return netlink.Message{}, ErrNilAttributeEncoder
 	}
 
 	// Encode the AE into a byte slice.
@@ -62,10 +84,107 @@ func EncodeNetlink(h Header, ae *netlink.AttributeEncoder) (netlink.Message, err
 	}
 
 	// Allocate space for the marshaled netfilter header.
-	nlm := netlink.Message{Data: append(make([]byte, nfHeaderLen), b...)}
+	nlm := netlink.Message{Data: append(make([]byte, nfHeaderLen, nfHeaderLen+len(b)), b...)}
 
 	// marshal error ignored, safe to do if msg Data is initialized.
 	_ = h.marshal(&nlm)
 
 	return nlm, nil
 }
+
+// Size of a netlink message header (nlmsghdr - 16 bytes)
+const nlmsgHeaderLen = 16
+
+// AppendNetlink appends the wire representation of a complete netlink message
+// to dst, consisting of a netlink header, the Netfilter header h and attrs.
+// The netlink header's Type and Flags are taken from h, its Length is
+// calculated and its Sequence and PID are left zero. This allows encoding
+// batches of messages into a single reusable buffer. On error, dst is returned
+// at its original length.
+func AppendNetlink(dst []byte, h Header, attrs []Attribute) ([]byte, error) {
+	l := nlmsgHeaderLen + nfHeaderLen + attributesLen(attrs)
+	if uint64(l) > math.MaxUint32 {
+		return dst, ErrMessageTooLarge
+	}
+
+	orig := dst
+	start := len(dst)
+	dst = slices.Grow(dst, l)
+	dst = append(dst, make([]byte, nlmsgHeaderLen+nfHeaderLen)...)
+
+	// Write the Netfilter header in place and copy the resulting netlink
+	// header fields into the wire format.
+	nlm := netlink.Message{Data: dst[start+nlmsgHeaderLen:]}
+	_ = h.marshal(&nlm)
+
+	nlh := dst[start : start+nlmsgHeaderLen]
+	nlenc.PutUint32(nlh[0:4], uint32(l))
+	nlenc.PutUint16(nlh[4:6], uint16(nlm.Header.Type))
+	nlenc.PutUint16(nlh[6:8], uint16(nlm.Header.Flags))
+
+	dst, err := appendAttributes(dst, attrs)
+	if err != nil {
+		return orig, err
+	}
+
+	return dst, nil
+}
+
+// A Message is a Netfilter message consisting of a Header and a list of
+// Attributes. Unlike netlink.Message, it does not hold the netlink header's
+// Length, Sequence and PID fields.
+type Message struct {
+	Header     Header      `json:"header"`
+	Attributes []Attribute `json:"attributes"`
+}
+
+// UnmarshalMessage unmarshals a netlink.Message into a Message, like
+// UnmarshalNetlink.
+func UnmarshalMessage(msg netlink.Message) (Message, error) {
+	h, attrs, err := UnmarshalNetlink(msg)
+	if err != nil {
+		return Message{}, err
+	}
+
+	return Message{Header: h, Attributes: attrs}, nil
+}
+
+// MarshalNetlink marshals the Message into a netlink.Message, like MarshalNetlink.
+func (m Message) MarshalNetlink() (netlink.Message, error) {
+	return MarshalNetlink(m.Header, m.Attributes)
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler. It returns the Message's
+// wire format including its netlink header, see AppendNetlink.
+func (m Message) MarshalBinary() ([]byte, error) {
+	return m.AppendBinary(nil)
+}
+
+// AppendBinary appends the Message's wire format to b, see MarshalBinary.
+func (m Message) AppendBinary(b []byte) ([]byte, error) {
+	return AppendNetlink(b, m.Header, m.Attributes)
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler. b must hold a single
+// netlink message including its netlink header. The Message does not retain b.
+func (m *Message) UnmarshalBinary(b []byte) error {
+	var nlm netlink.Message
+	if err := nlm.UnmarshalBinary(bytes.Clone(b)); err != nil {
+		return err
+	}
+
+	msg, err := UnmarshalMessage(nlm)
+	if err != nil {
+		return err
+	}
+
+	*m = msg
+
+	return nil
+}
+
+// Equal reports whether m and o have identical Headers and equal Attributes,
+// as defined by the Equal function.
+func (m Message) Equal(o Message) bool {
+	return m.Header == o.Header && Equal(m.Attributes, o.Attributes)
+}
@@ -1,10 +1,9 @@
 package netfilter
 
 import (
+	"errors"
 	"testing"
 
-	"github.com/pkg/errors"
-
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
@@ -18,14 +17,14 @@ func TestMessageUnmarshalNetlink(t *testing.T) {
 		attrs []Attribute
 		h     Header
 		msg   netlink.Message
-		err   error
+		err   *DecodeError
 	}{
 		{
 			name: "netlink message too short",
 			msg: netlink.Message{
 				Data: make([]byte, nfHeaderLen-1),
 			},
-			err: errors.Wrap(errMessageLen, "unmarshaling netfilter header"),
+			err: &DecodeError{Offset: 0, Err: ErrMessageLen},
 		},
 		{
 			name: "simple attribute",
@@ -46,7 +45,7 @@ func TestMessageUnmarshalNetlink(t *testing.T) {
 			msg: netlink.Message{
 				Data: make([]byte, nfHeaderLen+1),
 			},
-			err: errors.New("creating attribute decoder: invalid attribute; length too short or too large"),
+			err: &DecodeError{Offset: nfHeaderLen, Err: ErrInvalidAttributeLength},
 		},
 		{
 			name: "nested and byte order flags set",
@@ -58,7 +57,20 @@ func TestMessageUnmarshalNetlink(t *testing.T) {
 					nlenc.Uint16Bytes(netlink.Nested|netlink.NetByteOrder)...,
 				),
 			},
-			err: errInvalidAttributeFlags,
+			err: &DecodeError{Offset: nfHeaderLen, Path: []uint16{0}, Err: ErrInvalidAttributeFlags},
+		},
+		{
+			name: "invalid nested attribute",
+			msg: netlink.Message{
+				Data: []byte{
+					0, 0, 0, 0,
+					4, 0, 1, 0,
+					12, 0, 2, 0x80,
+					4, 0, 1, 0x80,
+					3, 0, 0, 0,
+				},
+			},
+			err: &DecodeError{Offset: 16, Path: []uint16{2}, Err: ErrInvalidAttributeLength},
 		},
 	}
 
@@ -69,8 +81,10 @@ func TestMessageUnmarshalNetlink(t *testing.T) {
 			h, attrs, err := UnmarshalNetlink(tt.msg)
 
 			if tt.err != nil {
-				require.Error(t, err)
-				require.EqualError(t, err, tt.err.Error())
+				var de *DecodeError
+				require.ErrorAs(t, err, &de)
+				assert.Equal(t, tt.err, de)
+				assert.ErrorIs(t, err, tt.err.Err)
 				return
 			}
 
@@ -82,6 +96,29 @@ func TestMessageUnmarshalNetlink(t *testing.T) {
 	}
 }
 
+func TestDecodeNetlink(t *testing.T) {
+	msg, err := MarshalNetlink(Header{SubsystemID: NFSubsysQueue}, []Attribute{{Type: 1, Data: []byte{1}}})
+	require.NoError(t, err)
+
+	h, ad, err := DecodeNetlink(msg)
+	require.NoError(t, err)
+	assert.Equal(t, NFSubsysQueue, h.SubsystemID)
+	require.True(t, ad.Next())
+	assert.Equal(t, uint16(1), ad.Type())
+
+	_, _, err = DecodeNetlink(netlink.Message{})
+	assert.ErrorIs(t, err, ErrMessageLen)
+
+	// Append a truncated attribute header.
+	msg.Data = append(msg.Data, 8, 0, 2)
+	_, _, err = DecodeNetlink(msg)
+
+	var de *DecodeError
+	require.ErrorAs(t, err, &de)
+	assert.Equal(t, nfHeaderLen+8, de.Offset)
+	assert.Empty(t, de.Path)
+}
+
 func TestAttributeMarshalNetlink(t *testing.T) {
 	tests := []struct {
 		name  string
@@ -127,7 +164,7 @@ func TestAttributeMarshalNetlink(t *testing.T) {
 					NetByteOrder: true,
 				},
 			},
-			err: errInvalidAttributeFlags,
+			err: ErrInvalidAttributeFlags,
 		},
 	}
 
@@ -148,7 +185,7 @@ func TestAttributeMarshalNetlink(t *testing.T) {
 
 func TestEncodeNetlink(t *testing.T) {
 	_, err := EncodeNetlink(Header{}, nil)
-	assert.EqualError(t, err, errNilAttributeEncoder.Error())
+	assert.EqualError(t, err, ErrNilAttributeEncoder.Error())
 
 	// Make ae.Encode() throw an error inside EncodeNetlink.
 	ae := NewAttributeEncoder()
@@ -156,3 +193,124 @@ func TestEncodeNetlink(t *testing.T) {
 	_, err = EncodeNetlink(Header{}, ae)
 	assert.EqualError(t, err, "test error")
 }
+
+func TestAppendNetlink(t *testing.T) {
+	h := Header{
+		Family:      ProtoIPv4,
+		Version:     1,
+		ResourceID:  0x1234,
+		SubsystemID: NFSubsysCTNetlink,
+		MessageType: 2,
+		Flags:       netlink.Request | netlink.Acknowledge,
+	}
+	attrs := []Attribute{
+		{Type: 1, Data: []byte{1, 2, 3}},
+		{Type: 2, Nested: true, Children: []Attribute{{Type: 1, Data: Uint32Bytes(1)}}},
+	}
+
+	want, err := MarshalNetlink(h, attrs)
+	require.NoError(t, err)
+	want.Header.Length = uint32(nlmsgHeaderLen + len(want.Data))
+
+	// Encode two messages back to back into the same buffer.
+	b, err := AppendNetlink(nil, h, attrs)
+	require.NoError(t, err)
+	b, err = AppendNetlink(b, h, nil)
+	require.NoError(t, err)
+
+	var got netlink.Message
+	require.NoError(t, got.UnmarshalBinary(b[:want.Header.Length]))
+	assert.Equal(t, want, got)
+
+	require.NoError(t, got.UnmarshalBinary(b[want.Header.Length:]))
+	assert.Equal(t, uint32(nlmsgHeaderLen+nfHeaderLen), got.Header.Length)
+	assert.Equal(t, want.Data[:nfHeaderLen], got.Data)
+
+	// The caller's buffer survives an encoding error.
+	out, err := AppendNetlink(b, h, []Attribute{{Nested: true, NetByteOrder: true}})
+	assert.ErrorIs(t, err, ErrInvalidAttributeFlags)
+	assert.Equal(t, b, out)
+}
+
+func TestMessageBinary(t *testing.T) {
+	m := Message{
+		Header: Header{
+			SubsystemID: NFSubsysCTNetlink,
+			MessageType: 2,
+			Family:      ProtoIPv4,
+			ResourceID:  0x1234,
+			Flags:       netlink.Request | netlink.Dump,
+		},
+		Attributes: pathTestTree(),
+	}
+
+	b, err := m.MarshalBinary()
+	require.NoError(t, err)
+
+	// The result must be identical to the netlink.Message produced by MarshalNetlink.
+	nlm, err := m.MarshalNetlink()
+	require.NoError(t, err)
+	nlm.Header.Length = uint32(nlmsgHeaderLen + len(nlm.Data))
+	want, err := nlm.MarshalBinary()
+	require.NoError(t, err)
+	assert.Equal(t, want, b)
+
+	var got Message
+	require.NoError(t, got.UnmarshalBinary(b))
+	assert.True(t, m.Equal(got))
+
+	// The Message must not retain the input buffer.
+	clear(b)
+	assert.True(t, m.Equal(got))
+
+	out, err := got.AppendBinary([]byte{0xff})
+	require.NoError(t, err)
+	assert.Equal(t, want, out[1:])
+
+	got.Header.ResourceID = 1
+	assert.False(t, m.Equal(got))
+
+	// Short, truncated and malformed messages.
+	assert.Error(t, got.UnmarshalBinary(want[:8]))
+	assert.Error(t, got.UnmarshalBinary(want[:len(want)-4]))
+
+	short, err := netlink.Message{Header: netlink.Header{Length: nlmsgHeaderLen}}.MarshalBinary()
+	require.NoError(t, err)
+	assert.ErrorIs(t, got.UnmarshalBinary(short), ErrMessageLen)
+}
+
+func TestUnmarshalMessage(t *testing.T) {
+	h := Header{SubsystemID: NFSubsysQueue, MessageType: 1}
+	nlm, err := MarshalNetlink(h, []Attribute{{Type: 1, Data: []byte{1}}})
+	require.NoError(t, err)
+
+	m, err := UnmarshalMessage(nlm)
+	require.NoError(t, err)
+	assert.Equal(t, h, m.Header)
+	assert.Len(t, m.Attributes, 1)
+
+	_, err = UnmarshalMessage(netlink.Message{})
+	assert.Error(t, err)
+}
+
+func BenchmarkMarshalNetlink(b *testing.B) {
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := MarshalNetlink(Header{}, viewTestAttrs); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAppendNetlink(b *testing.B) {
+	b.ReportAllocs()
+
+	var buf []byte
+	for i := 0; i < b.N; i++ {
+		var err error
+		if buf, err = AppendNetlink(buf[:0], Header{}, viewTestAttrs); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package netfilter
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"os"
+	"time"
+
+	"github.com/mdlayher/netlink"
+)
+
+// A waiter is a query waiting for its response, see roundTrip.
+type waiter struct {
+	msgs []netlink.Message
+	err  error
+
+	// Set if any message of the response, including its Done message, has the
+	// DumpInterrupted flag set.
+	interrupted bool
+
+	// Closed once msgs or err hold the response.
+	done chan struct{}
+}
+
+// roundTrip sends request nlm and returns the kernel's response, like
+// netlink.Conn.Execute, and whether the kernel reported the response to be
+// interrupted by a concurrent change. Unlike Execute, it doesn't hold the socket
+// while waiting for the response, so concurrent calls are pipelined: every
+// request is sent with a distinct sequence number assigned by the Conn, and a
+// single reader goroutine hands the responses read from the socket to the caller
+// waiting for them.
+//
+// When ctx is done while no other queries are waiting, the reader's socket read
+// is interrupted by moving the read deadline into the past, like withContext.
+// This clears any deadline set using SetReadDeadline.
+//
+// Must be called with c.reqMu held for reading. Sockets not supporting raw
+// access, like those created by nltest, fall back to Execute.
+func (c *Conn) roundTrip(ctx context.Context, nlm netlink.Message) ([]netlink.Message, bool, error) {
+	if c.recvRaw == nil {
+		if _, err := c.conn.SyscallConn(); err != nil {
+			// Let Execute assign a sequence number, like the Conn does below.
+			nlm.Header.Sequence = 0
+
+			var msgs []netlink.Message
+			err := c.withContext(ctx, func() (err error) {
+				msgs, err = c.conn.Execute(nlm)
+				return err
+			})
+			return msgs, dumpInterrupted(msgs), err
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+
+	w := &waiter{done: make(chan struct{})}
+
+	// Register the waiter while holding muxMu across the send, so the reader
+	// can't dispatch the response before the waiter is known.
+	c.muxMu.Lock()
+
+	if c.waiters == nil {
+		c.waiters = make(map[uint32]*waiter)
+	}
+
+	// Replace the caller's sequence number, which may be in use by another
+	// query, with one no other waiter holds.
+	seq := c.nextSequence()
+	nlm.Header.Sequence = seq
+
+	if _, err := c.conn.Send(nlm); err != nil {
+		c.muxMu.Unlock()
+		return nil, false, err
+	}
+	c.waiters[seq] = w
+
+	if c.reader == nil {
+		c.reader = make(chan struct{})
+		go c.readResponses(c.reader)
+	}
+	c.muxMu.Unlock()
+
+	select {
+	case <-w.done:
+		return w.msgs, w.interrupted, w.err
+	case <-ctx.Done():
+	}
+
+	c.muxMu.Lock()
+	defer c.muxMu.Unlock()
+
+	// The response may have arrived in the meantime, in which case the waiter
+	// was completed while holding muxMu.
+	select {
+	case <-w.done:
+		return w.msgs, w.interrupted, w.err
+	default:
+	}
+	delete(c.waiters, seq)
+
+	// Nobody is waiting for the reader anymore, interrupt its read so it exits.
+	if len(c.waiters) == 0 && c.reader != nil {
+		c.interrupted = true
+		_ = c.conn.SetReadDeadline(time.Unix(1, 0))
+	}
+
+	return nil, false, ctx.Err()
+}
+
+// nextSequence returns a non-zero sequence number not used by any waiter. Must
+// be called with c.muxMu held.
+func (c *Conn) nextSequence() uint32 {
+	// Start at a random number like netlink.Conn, making it unlikely to match
+	// the sequence numbers of earlier requests on the socket.
+	if c.seq == 0 {
+		c.seq = rand.Uint32()
+	}
+
+	for {
+		c.seq++
+		if _, ok := c.waiters[c.seq]; !ok && c.seq != 0 {
+			return c.seq
+		}
+	}
+}
+
+// readResponses reads datagrams from the socket and dispatches their messages
+// to the waiters for their sequence numbers, until no waiters remain. Messages
+// for unknown sequence numbers, such as the responses to abandoned queries, are
+// discarded. A failing read fails all waiters. Closes done when it returns.
+func (c *Conn) readResponses(done chan struct{}) {
+	defer close(done)
+
+	for {
+		msgs, err := c.receiveRaw()
+
+		c.muxMu.Lock()
+
+		if c.interrupted {
+			// Clear the deadline set to interrupt the read. Any waiters that
+			// registered since then need the reader to continue.
+			c.interrupted = false
+			_ = c.conn.SetReadDeadline(time.Time{})
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				err = nil
+			}
+		}
+
+		if err != nil {
+			for seq, w := range c.waiters {
+				w.err = err
+				close(w.done)
+				delete(c.waiters, seq)
+			}
+		}
+
+		c.dispatch(msgs)
+
+		if len(c.waiters) == 0 {
+			c.reader = nil
+			c.muxMu.Unlock()
+			return
+		}
+
+		c.muxMu.Unlock()
+	}
+}
+
+// dispatch hands the messages of a datagram to their waiters, completing the
+// waiters whose response is complete. Like netlink.Conn.Execute, a response
+// ends with an error message, the end of a multipart message, or any datagram
+// whose last message for the waiter isn't part of a multipart message. Must be
+// called with c.muxMu held.
+func (c *Conn) dispatch(msgs []netlink.Message) {
+	// Waiters that received messages from this datagram.
+	var got []uint32
+
+	for _, m := range msgs {
+		seq := m.Header.Sequence
+		w, ok := c.waiters[seq]
+		if !ok {
+			continue
+		}
+
+		// The flag may only be set on the Done message, when the change
+		// happened after the last data message was dumped.
+		if m.Header.Flags&netlink.DumpInterrupted != 0 {
+			w.interrupted = true
+		}
+
+		switch m.Header.Type {
+		case netlink.Error:
+			if err := ackError(m); err != nil {
+				w.msgs, w.err = nil, err
+				c.complete(seq, w)
+				continue
+			}
+		case netlink.Done:
+			if m.Header.Flags&netlink.Multi != 0 {
+				w.err = doneError(m)
+				c.complete(seq, w)
+				continue
+			}
+		}
+
+		// Messages alias the datagram, which isn't reused.
+		w.msgs = append(w.msgs, m)
+		got = append(got, seq)
+	}
+
+	for _, seq := range got {
+		w, ok := c.waiters[seq]
+		if !ok {
+			continue
+		}
+		if last := w.msgs[len(w.msgs)-1]; last.Header.Flags&netlink.Multi == 0 {
+			c.complete(seq, w)
+		}
+	}
+}
+
+// complete removes w from the waiters and wakes it up.
+func (c *Conn) complete(seq uint32, w *waiter) {
+	delete(c.waiters, seq)
+	close(w.done)
+}
+
+// waitReader waits for the reader started by roundTrip to exit, so the caller
+// can read from the socket itself. Must be called with c.reqMu held for writing,
+// which guarantees no waiters remain.
+func (c *Conn) waitReader() {
+	c.muxMu.Lock()
+	r := c.reader
+	c.muxMu.Unlock()
+
+	if r != nil {
+		<-r
+	}
+}
@@ -0,0 +1,281 @@
+package netfilter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mdlayher/netlink"
+	"github.com/mdlayher/netlink/nltest"
+	"golang.org/x/sys/unix"
+)
+
+// pipeTestConn returns a Conn whose requests are answered by fn. The
+// datagrams it returns are read from the Conn's socket in order, one per
+// receive. Receives block until a datagram is available.
+func pipeTestConn(fn func(req netlink.Message) [][]netlink.Message) *Conn {
+	dgs := make(chan []netlink.Message, 1024)
+
+	c := &Conn{conn: nltest.Dial(func(req []netlink.Message) ([]netlink.Message, error) {
+		for _, dg := range fn(req[0]) {
+			dgs <- dg
+		}
+		return nil, nil
+	})}
+
+	c.recvRaw = func() ([]netlink.Message, error) {
+		dg, ok := <-dgs
+		if !ok {
+			return nil, errors.New("closed")
+		}
+		return dg, nil
+	}
+
+	return c
+}
+
+// echoReply returns a reply to req carrying its payload.
+func echoReply(req netlink.Message) netlink.Message {
+	return netlink.Message{Header: netlink.Header{Sequence: req.Header.Sequence}, Data: req.Data}
+}
+
+func TestConnQueryConcurrent(t *testing.T) {
+	// Hold back every other reply until the next request is sent, so replies
+	// arrive out of order.
+	var (
+		mu   sync.Mutex
+		held []netlink.Message
+	)
+	c := pipeTestConn(func(req netlink.Message) [][]netlink.Message {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if held == nil {
+			held = []netlink.Message{echoReply(req)}
+			return nil
+		}
+
+		dgs := [][]netlink.Message{{echoReply(req)}, held}
+		held = nil
+		return dgs
+	})
+
+	var wg sync.WaitGroup
+	for i := range 64 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			req, err := MarshalNetlink(Header{SubsystemID: NFSubsysCTNetlink},
+				[]Attribute{{Type: 1, Data: Uint32Bytes(uint32(i))}})
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			msgs, err := c.Query(req)
+			if !assert.NoError(t, err) || !assert.Len(t, msgs, 1) {
+				return
+			}
+
+			_, attrs, err := UnmarshalNetlink(msgs[0])
+			if assert.NoError(t, err) {
+				assert.Equal(t, uint32(i), attrs[0].Uint32(), "reply for another query")
+			}
+		}()
+	}
+	wg.Wait()
+
+	// The reader exits once all queries are answered.
+	c.waitReader()
+	assert.Empty(t, c.waiters)
+}
+
+func TestConnQueryPipelined(t *testing.T) {
+	c := pipeTestConn(func(req netlink.Message) [][]netlink.Message {
+		seq := req.Header.Sequence
+		switch req.Data[0] {
+		case 1:
+			// Multipart reply spanning two datagrams, interleaved with
+			// messages for unknown requests.
+			multi := netlink.Message{Header: netlink.Header{Flags: netlink.Multi, Sequence: seq}, Data: []byte{0, 0, 0, 0}}
+			done := netlink.Message{
+				Header: netlink.Header{Type: netlink.Done, Flags: netlink.Multi, Sequence: seq},
+				Data:   []byte{0, 0, 0, 0},
+			}
+			return [][]netlink.Message{
+				{multi, {Header: netlink.Header{Sequence: seq + 1000}}},
+				{multi, done},
+			}
+		case 2:
+			return [][]netlink.Message{{errorMessage(req, unix.ENOENT, "", 0)}}
+		case 3:
+			ack := errorMessage(req, 0, "", 0)
+			return [][]netlink.Message{{ack}}
+		}
+		return nil
+	})
+
+	msgs, err := c.Query(netlink.Message{Data: []byte{1, 0, 0, 0}})
+	require.NoError(t, err)
+	assert.Len(t, msgs, 2)
+
+	_, err = c.Query(netlink.Message{Data: []byte{2, 0, 0, 0}})
+	var oe *OpError
+	require.ErrorAs(t, err, &oe)
+	assert.ErrorIs(t, err, unix.ENOENT)
+
+	msgs, err = c.Query(netlink.Message{Data: []byte{3, 0, 0, 0}})
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+	assert.Equal(t, netlink.Error, msgs[0].Header.Type)
+
+	// Queries that are never answered can be cancelled, after which the Conn
+	// remains usable.
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error)
+	go func() {
+		_, err := c.QueryContext(ctx, netlink.Message{Data: []byte{4, 0, 0, 0}})
+		errc <- err
+	}()
+	cancel()
+	assert.ErrorIs(t, <-errc, context.Canceled)
+
+	_, err = c.Query(netlink.Message{Data: []byte{3, 0, 0, 0}})
+	assert.NoError(t, err)
+}
+
+func TestConnQuerySequenceCollision(t *testing.T) {
+	// Hold back replies until both queries have been sent.
+	var (
+		mu   sync.Mutex
+		held [][]netlink.Message
+	)
+	c := pipeTestConn(func(req netlink.Message) [][]netlink.Message {
+		mu.Lock()
+		defer mu.Unlock()
+
+		held = append(held, []netlink.Message{echoReply(req)})
+		if len(held) < 2 {
+			return nil
+		}
+		return held
+	})
+
+	var wg sync.WaitGroup
+	for i := range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			req := netlink.Message{Header: netlink.Header{Sequence: 42}, Data: []byte{byte(i), 0, 0, 0}}
+			msgs, err := c.QueryContext(ctx, req)
+			if assert.NoError(t, err) && assert.Len(t, msgs, 1) {
+				assert.Equal(t, byte(i), msgs[0].Data[0], "reply for another query")
+				assert.NotEqual(t, uint32(42), msgs[0].Header.Sequence)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestConnQuerySequence(t *testing.T) {
+	var sent []uint32
+	c := pipeTestConn(func(req netlink.Message) [][]netlink.Message {
+		sent = append(sent, req.Header.Sequence)
+		return [][]netlink.Message{{echoReply(req)}}
+	})
+
+	// The caller's sequence number is replaced by one assigned by the Conn.
+	req := netlink.Message{Header: netlink.Header{Sequence: 42}, Data: []byte{0, 0, 0, 0}}
+	for range 2 {
+		msgs, err := c.Query(req)
+		require.NoError(t, err)
+		require.Len(t, msgs, 1)
+		assert.Equal(t, sent[len(sent)-1], msgs[0].Header.Sequence)
+	}
+
+	require.Len(t, sent, 2)
+	assert.NotContains(t, sent, uint32(42))
+	assert.NotContains(t, sent, uint32(0))
+	assert.NotEqual(t, sent[0], sent[1])
+	assert.Equal(t, uint32(42), req.Header.Sequence, "caller's message must not be modified")
+
+	// The same applies to sockets without raw access.
+	var fallback uint32
+	nc := Conn{conn: nltest.Dial(func(req []netlink.Message) ([]netlink.Message, error) {
+		fallback = req[0].Header.Sequence
+		return []netlink.Message{echoReply(req[0])}, nil
+	})}
+
+	_, err := nc.Query(req)
+	require.NoError(t, err)
+	assert.NotEqual(t, uint32(42), fallback)
+}
+
+func TestConnQueryReadError(t *testing.T) {
+	c := pipeTestConn(func(req netlink.Message) [][]netlink.Message { return nil })
+
+	errRead := errors.New("read failed")
+	c.recvRaw = func() ([]netlink.Message, error) { return nil, errRead }
+
+	_, err := c.Query(netlink.Message{Data: []byte{0, 0, 0, 0}})
+	assert.ErrorIs(t, err, errRead)
+}
+
+// benchmarkQueryParallel runs a stats query against the kernel from parallel
+// goroutines. serial sends queries using netlink.Conn.Execute, which makes them
+// wait for each other's responses, like Query did before pipelining.
+func benchmarkQueryParallel(b *testing.B, serial bool) {
+	c, err := Dial(nil)
+	require.NoError(b, err)
+	defer c.Close()
+
+	// IPCTNL_MSG_CT_GET_STATS, answered with a single message.
+	req, err := MarshalNetlink(Header{
+		SubsystemID: NFSubsysCTNetlink,
+		MessageType: 5,
+		Family:      ProtoIPv4,
+		Flags:       netlink.Request | netlink.Acknowledge,
+	}, nil)
+	require.NoError(b, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := c.QueryContext(ctx, req); err != nil {
+		b.Skipf("conntrack stats unavailable: %v", err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			var err error
+			if serial {
+				_, err = c.conn.Execute(req)
+			} else {
+				_, err = c.Query(req)
+			}
+			if err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+func BenchmarkConnQueryParallel(b *testing.B) {
+	benchmarkQueryParallel(b, false)
+}
+
+func BenchmarkConnQueryParallelSerial(b *testing.B) {
+	benchmarkQueryParallel(b, true)
+}
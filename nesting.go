@@ -0,0 +1,49 @@
+package netfilter
+
+import "sync"
+
+// A NestingSchema lists attribute types whose payload consists of nested
+// attributes, even though the kernel does not set the NLA_F_NESTED flag on
+// them. This is the case for parts of nf_tables and ipset. Each type maps to
+// the NestingSchema of its children, which may be nil.
+//
+// Attributes decoded using a schema have their Children populated, but keep
+// their Nested field unset, so they are re-encoded without the flag and the
+// resulting message is identical to the one received.
+type NestingSchema map[uint16]NestingSchema
+
+type nestingKey struct {
+	subsys SubsystemID
+	mt     MessageType
+}
+
+var nestingSchemas = struct {
+	sync.RWMutex
+	m map[nestingKey]NestingSchema
+}{m: make(map[nestingKey]NestingSchema)}
+
+// RegisterNestingSchema registers schema for decoding messages of message type
+// mt in subsystem subsys, for use by UnmarshalNetlink. Registering a nil schema
+// removes an existing registration. It is typically called from the init
+// function of a subsystem package.
+func RegisterNestingSchema(subsys SubsystemID, mt MessageType, schema NestingSchema) {
+	nestingSchemas.Lock()
+	defer nestingSchemas.Unlock()
+
+	k := nestingKey{subsys, mt}
+	if schema == nil {
+		delete(nestingSchemas.m, k)
+		return
+	}
+
+	nestingSchemas.m[k] = schema
+}
+
+// lookupNestingSchema returns the NestingSchema registered for subsys and mt,
+// or nil if there is none.
+func lookupNestingSchema(subsys SubsystemID, mt MessageType) NestingSchema {
+	nestingSchemas.RLock()
+	defer nestingSchemas.RUnlock()
+
+	return nestingSchemas.m[nestingKey{subsys, mt}]
+}
@@ -0,0 +1,152 @@
+package netfilter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mdlayher/netlink"
+)
+
+// nestingTestAttrs contains an attribute (1) with nested attributes in its
+// payload but without the Nested flag, holding another unflagged nested
+// attribute (2) and an empty one (3).
+func nestingTestAttrs() []Attribute {
+	return []Attribute{
+		{Type: 1, Children: []Attribute{
+			{Type: 1, Data: Uint32Bytes(1)},
+			{Type: 2, Children: []Attribute{
+				{Type: 1, Data: Uint16Bytes(2)},
+			}},
+			{Type: 3, Children: []Attribute{}},
+		}},
+		{Type: 2, Data: Uint32Bytes(3)},
+	}
+}
+
+var nestingTestSchema = NestingSchema{
+	1: {
+		2: nil,
+		3: nil,
+	},
+}
+
+func TestAttributeChildrenWithoutNested(t *testing.T) {
+	b, err := MarshalAttributes(nestingTestAttrs())
+	require.NoError(t, err)
+
+	// Without a schema, the unflagged attributes are opaque.
+	attrs, err := UnmarshalAttributes(b)
+	require.NoError(t, err)
+	require.Len(t, attrs, 2)
+	assert.False(t, attrs[0].Nested)
+	assert.Nil(t, attrs[0].Children)
+
+	// The legacy encoder must produce the same bytes as AppendAttributes.
+	ae := netlink.NewAttributeEncoder()
+	require.NoError(t, encodeAttributes(ae, nestingTestAttrs()))
+	legacy, err := ae.Encode()
+	require.NoError(t, err)
+	assert.Equal(t, b, legacy)
+
+	var l int
+	for _, a := range nestingTestAttrs() {
+		l += a.EncodedLen()
+	}
+	assert.Equal(t, len(b), l)
+}
+
+func TestUnmarshalAttributesWithSchema(t *testing.T) {
+	b, err := MarshalAttributes(nestingTestAttrs())
+	require.NoError(t, err)
+
+	attrs, err := UnmarshalAttributesWithSchema(b, nestingTestSchema)
+	require.NoError(t, err)
+
+	require.Len(t, attrs, 2)
+	assert.False(t, attrs[0].Nested)
+	assert.Equal(t, b[4:4+len(attrs[0].Data)], attrs[0].Data)
+
+	a := FindAttribute(attrs, 1, 2, 1)
+	require.NotNil(t, a)
+	assert.Equal(t, Uint16Bytes(2), a.Data)
+
+	a = FindAttribute(attrs, 1, 3)
+	require.NotNil(t, a)
+	assert.NotNil(t, a.Children)
+	assert.Empty(t, a.Children)
+
+	// Re-encoding must be byte-identical.
+	out, err := MarshalAttributes(attrs)
+	require.NoError(t, err)
+	assert.Equal(t, b, out)
+
+	// Hinted attributes are accepted as nested by policies.
+	err = Policy{1: {Kind: KindNested, Nested: Policy{2: {Kind: KindNested}}}}.Validate(attrs)
+	assert.NoError(t, err)
+
+	// A hinted attribute with a payload that isn't made up of attributes.
+	b, err = MarshalAttributes([]Attribute{{Type: 1, Data: []byte{0xff, 0xff, 0xff}}})
+	require.NoError(t, err)
+	_, err = UnmarshalAttributesWithSchema(b, NestingSchema{1: nil})
+	assert.Error(t, err)
+}
+
+func TestUnmarshalNetlinkNestingSchema(t *testing.T) {
+	h := Header{SubsystemID: NFSubsysIPSet, MessageType: 1}
+
+	msg, err := MarshalNetlink(h, nestingTestAttrs())
+	require.NoError(t, err)
+
+	_, attrs, err := UnmarshalNetlink(msg)
+	require.NoError(t, err)
+	assert.Nil(t, attrs[0].Children)
+
+	RegisterNestingSchema(h.SubsystemID, h.MessageType, nestingTestSchema)
+	t.Cleanup(func() { RegisterNestingSchema(h.SubsystemID, h.MessageType, nil) })
+
+	_, attrs, err = UnmarshalNetlink(msg)
+	require.NoError(t, err)
+	assert.NotNil(t, FindAttribute(attrs, 1, 2, 1))
+
+	out, err := MarshalNetlink(h, attrs)
+	require.NoError(t, err)
+	assert.Equal(t, msg.Data, out.Data)
+
+	// Other message types of the subsystem are unaffected.
+	h.MessageType = 2
+	msg, err = MarshalNetlink(h, nestingTestAttrs())
+	require.NoError(t, err)
+
+	_, attrs, err = UnmarshalNetlink(msg)
+	require.NoError(t, err)
+	assert.Nil(t, attrs[0].Children)
+}
+
+func TestUnmarshalAttributesWithSchemaNetByteOrder(t *testing.T) {
+	inner, err := MarshalAttributes([]Attribute{{Type: 1, Data: Uint32Bytes(1)}})
+	require.NoError(t, err)
+
+	// A nested payload flagged as being in network byte order instead.
+	b, err := MarshalAttributes([]Attribute{{Type: 1, NetByteOrder: true, Data: inner}})
+	require.NoError(t, err)
+
+	attrs, err := UnmarshalAttributesWithSchema(b, NestingSchema{1: nil})
+	require.NoError(t, err)
+	require.Len(t, attrs, 1)
+	assert.True(t, attrs[0].NetByteOrder)
+	assert.False(t, attrs[0].Nested)
+	require.Len(t, attrs[0].Children, 1)
+
+	// Re-encoding must be byte-identical, using both encoders.
+	out, err := MarshalAttributes(attrs)
+	require.NoError(t, err)
+	assert.Equal(t, b, out)
+
+	ae := netlink.NewAttributeEncoder()
+	require.NoError(t, encodeAttributes(ae, attrs))
+	legacy, err := ae.Encode()
+	require.NoError(t, err)
+	assert.Equal(t, b, legacy)
+}
@@ -0,0 +1,187 @@
+package netfilter
+
+import "github.com/mdlayher/netlink/nlenc"
+
+// FindAttribute returns a pointer to the first Attribute matching path, a list
+// of attribute types starting at the top level of attrs and descending into the
+// Children of nested attributes. For example, the path {1, 2} finds the first
+// attribute of type 2 nested within the first attribute of type 1 that contains
+// one. Returns nil if no Attribute matches.
+//
+// The returned pointer refers to an element of attrs or one of its descendants,
+// so it can be used to modify the tree in place. It is invalidated by any
+// operation that reallocates the containing slice, like SetAttribute.
+func FindAttribute(attrs []Attribute, path ...uint16) *Attribute {
+	if len(path) == 0 {
+		return nil
+	}
+
+	for i := range attrs {
+		if attrs[i].Type != path[0] {
+			continue
+		}
+
+		if len(path) == 1 {
+			return &attrs[i]
+		}
+
+		if a := FindAttribute(attrs[i].Children, path[1:]...); a != nil {
+			return a
+		}
+	}
+
+	return nil
+}
+
+// FindAttributes returns pointers to all Attributes matching path, in the
+// order they appear in the tree. Repeated attributes at any level of the path
+// are all descended into. See FindAttribute for the meaning of path.
+func FindAttributes(attrs []Attribute, path ...uint16) []*Attribute {
+	return findAttributes(nil, attrs, path)
+}
+
+func findAttributes(out []*Attribute, attrs []Attribute, path []uint16) []*Attribute {
+	if len(path) == 0 {
+		return out
+	}
+
+	for i := range attrs {
+		if attrs[i].Type != path[0] {
+			continue
+		}
+
+		if len(path) == 1 {
+			out = append(out, &attrs[i])
+			continue
+		}
+
+		out = findAttributes(out, attrs[i].Children, path[1:])
+	}
+
+	return out
+}
+
+// SetAttribute stores a in the list of attributes found at parents, a path of
+// nested attribute types leading up to a. The first attribute with the same
+// type as a is replaced, or a is appended if none exists. Missing parents are
+// created as empty nested attributes along the way. Attributes with a parent's
+// type that don't hold nested attributes are left untouched, and a new parent
+// is created next to them. An empty parents path operates on attrs itself.
+//
+// The Data of every parent on the path is cleared, since it no longer reflects
+// the parent's Children. Returns the updated top-level list of attributes.
+func SetAttribute(attrs []Attribute, a Attribute, parents ...uint16) []Attribute {
+	if len(parents) == 0 {
+		for i := range attrs {
+			if attrs[i].Type == a.Type {
+				attrs[i] = a
+				return attrs
+			}
+		}
+		return append(attrs, a)
+	}
+
+	// Only attributes holding nested attributes can be parents, never replace
+	// a scalar attribute's payload.
+	var p *Attribute
+	for i := range attrs {
+		if attrs[i].Type == parents[0] && attrs[i].hasChildren() {
+			p = &attrs[i]
+			break
+		}
+	}
+	if p == nil {
+		attrs = append(attrs, Attribute{Type: parents[0], Nested: true})
+		p = &attrs[len(attrs)-1]
+	}
+
+	p.Children = SetAttribute(p.Children, a, parents[1:]...)
+	p.Data = nil
+
+	return attrs
+}
+
+// DeleteAttribute removes all Attributes matching path from the tree. The Data
+// of parents losing a child is cleared, since it no longer reflects the
+// parent's Children. Returns the updated top-level list of attributes and the
+// amount of attributes removed. Like slices.DeleteFunc, it reuses the backing
+// arrays of attrs and its descendants.
+func DeleteAttribute(attrs []Attribute, path ...uint16) ([]Attribute, int) {
+	if len(path) == 0 {
+		return attrs, 0
+	}
+
+	var n int
+	out := attrs[:0]
+	for _, a := range attrs {
+		if a.Type != path[0] {
+			out = append(out, a)
+			continue
+		}
+
+		if len(path) == 1 {
+			n++
+			continue
+		}
+
+		var removed int
+		a.Children, removed = DeleteAttribute(a.Children, path[1:]...)
+		if removed != 0 {
+			a.Data = nil
+			n += removed
+		}
+		out = append(out, a)
+	}
+
+	return out, n
+}
+
+// attributePath returns the types of the attributes leading up to and including
+// the innermost attribute in b that contains off, a byte offset relative to the
+// start of b. Attributes whose payload contains off are descended into if they
+// are nested, or if their payload is a valid list of attributes, since some
+// subsystems omit the Nested flag. Returns nil if off lies outside of b's
+// attributes.
+func attributePath(b []byte, off int) []uint16 {
+	var path []uint16
+
+	it := NewAttributeIterator(b)
+	for it.Next() {
+		v := it.View()
+
+		start := it.Offset()
+		if off < start || off >= start+nlaHeaderLen+len(v.Data()) {
+			continue
+		}
+		path = append(path, v.Type())
+
+		// Offset points to the attribute's header, or into a scalar payload.
+		data := start + nlaHeaderLen
+		if off < data || (!v.Nested() && !validAttributes(v.Data())) {
+			break
+		}
+
+		it = NewAttributeIterator(v.Data())
+		off -= data
+	}
+
+	return path
+}
+
+// validAttributes returns true if b consists of one or more well-formed
+// attributes. Unlike AttributeIterator, it rejects zero-length attributes,
+// which are never sent and are likely part of a scalar payload.
+func validAttributes(b []byte) bool {
+	if len(b) == 0 {
+		return false
+	}
+
+	it := NewAttributeIterator(b)
+	for it.Next() {
+		if nlenc.Uint16(b[it.Offset():it.Offset()+2]) == 0 {
+			return false
+		}
+	}
+
+	return it.Err() == nil
+}
@@ -0,0 +1,160 @@
+package netfilter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pathTestTree resembles a conntrack message with an original and a reply tuple.
+func pathTestTree() []Attribute {
+	return []Attribute{
+		{Type: 1, Nested: true, Data: []byte{0xff}, Children: []Attribute{
+			{Type: 1, Nested: true, Children: []Attribute{
+				{Type: 1, Data: []byte{10, 0, 0, 1}},
+				{Type: 2, Data: []byte{10, 0, 0, 2}},
+			}},
+			{Type: 2, Data: []byte{6}},
+		}},
+		{Type: 2, Nested: true, Children: []Attribute{
+			{Type: 1, Nested: true, Children: []Attribute{
+				{Type: 1, Data: []byte{10, 0, 0, 2}},
+				{Type: 2, Data: []byte{10, 0, 0, 1}},
+			}},
+		}},
+		{Type: 3, Data: Uint32Bytes(1)},
+		{Type: 3, Data: Uint32Bytes(2)},
+	}
+}
+
+func TestFindAttribute(t *testing.T) {
+	attrs := pathTestTree()
+
+	a := FindAttribute(attrs, 2, 1, 1)
+	require.NotNil(t, a)
+	assert.Equal(t, []byte{10, 0, 0, 2}, a.Data)
+
+	a = FindAttribute(attrs, 3)
+	require.NotNil(t, a)
+	assert.Equal(t, Uint32Bytes(1), a.Data)
+
+	assert.Nil(t, FindAttribute(attrs, 1, 3))
+	assert.Nil(t, FindAttribute(attrs, 3, 1))
+	assert.Nil(t, FindAttribute(attrs))
+
+	// Modify the tree through the returned pointer.
+	FindAttribute(attrs, 1, 1, 1).Data = []byte{192, 168, 0, 1}
+	assert.Equal(t, []byte{192, 168, 0, 1}, attrs[0].Children[0].Children[0].Data)
+}
+
+func TestFindAttributes(t *testing.T) {
+	attrs := pathTestTree()
+
+	all := FindAttributes(attrs, 3)
+	require.Len(t, all, 2)
+	assert.Equal(t, Uint32Bytes(2), all[1].Data)
+
+	assert.Len(t, FindAttributes(attrs, 1, 1, 2), 1)
+	assert.Empty(t, FindAttributes(attrs, 4))
+	assert.Empty(t, FindAttributes(attrs))
+}
+
+func TestSetAttribute(t *testing.T) {
+	attrs := pathTestTree()
+
+	// Replace an existing nested attribute.
+	attrs = SetAttribute(attrs, Attribute{Type: 2, Data: []byte{17}}, 1)
+	assert.Equal(t, []byte{17}, FindAttribute(attrs, 1, 2).Data)
+	assert.Nil(t, attrs[0].Data, "parent data must be cleared")
+	assert.Len(t, attrs[0].Children, 2)
+
+	// Append to an existing parent.
+	attrs = SetAttribute(attrs, Attribute{Type: 3, Data: []byte{1}}, 2, 1)
+	assert.Len(t, FindAttribute(attrs, 2, 1).Children, 3)
+
+	// Create missing parents.
+	attrs = SetAttribute(attrs, Attribute{Type: 1, Data: []byte{2}}, 4, 5)
+	p := FindAttribute(attrs, 4)
+	require.NotNil(t, p)
+	assert.True(t, p.Nested)
+	assert.Equal(t, []byte{2}, FindAttribute(attrs, 4, 5, 1).Data)
+
+	// Replace the first of a repeated top-level attribute.
+	attrs = SetAttribute(attrs, Attribute{Type: 3, Data: Uint32Bytes(5)})
+	all := FindAttributes(attrs, 3)
+	require.Len(t, all, 2)
+	assert.Equal(t, Uint32Bytes(5), all[0].Data)
+	assert.Equal(t, Uint32Bytes(2), all[1].Data)
+
+	// Scalar attributes are never used as parents.
+	attrs = SetAttribute(attrs, Attribute{Type: 1, Data: []byte{3}}, 3)
+	all = FindAttributes(attrs, 3)
+	require.Len(t, all, 3)
+	assert.Equal(t, Uint32Bytes(5), all[0].Data)
+	assert.Equal(t, Uint32Bytes(2), all[1].Data)
+	assert.True(t, all[2].Nested)
+	assert.Equal(t, []Attribute{{Type: 1, Data: []byte{3}}}, all[2].Children)
+
+	// The result must remain encodable.
+	_, err := MarshalAttributes(attrs)
+	require.NoError(t, err)
+}
+
+func TestDeleteAttribute(t *testing.T) {
+	attrs := pathTestTree()
+
+	attrs, n := DeleteAttribute(attrs, 3)
+	assert.Equal(t, 2, n)
+	assert.Len(t, attrs, 2)
+
+	attrs, n = DeleteAttribute(attrs, 1, 1, 2)
+	assert.Equal(t, 1, n)
+	assert.Nil(t, attrs[0].Data, "parent data must be cleared")
+	assert.Nil(t, FindAttribute(attrs, 1, 1, 2))
+	assert.NotNil(t, FindAttribute(attrs, 1, 1, 1))
+
+	attrs, n = DeleteAttribute(attrs, 5, 1)
+	assert.Equal(t, 0, n)
+	assert.Len(t, attrs, 2)
+
+	_, n = DeleteAttribute(attrs)
+	assert.Equal(t, 0, n)
+}
+
+func TestAttributePath(t *testing.T) {
+	b, err := MarshalAttributes([]Attribute{
+		{Type: 1, Data: Uint32Bytes(1)},
+		{Type: 2, Nested: true, Children: []Attribute{
+			{Type: 1, Data: Uint32Bytes(2)},
+			// Nested payload without the Nested flag.
+			{Type: 2, Children: []Attribute{
+				{Type: 3, Data: Uint16Bytes(3)},
+			}},
+		}},
+		{Type: 3, Data: []byte{0, 0, 0, 8, 0, 1, 0, 0}},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		off  int
+		path []uint16
+	}{
+		{off: 0, path: []uint16{1}},
+		{off: 6, path: []uint16{1}},
+		{off: 8, path: []uint16{2}},
+		{off: 12, path: []uint16{2, 1}},
+		{off: 20, path: []uint16{2, 2}},
+		{off: 24, path: []uint16{2, 2, 3}},
+		{off: 29, path: []uint16{2, 2, 3}},
+		{off: 30, path: []uint16{2, 2}},
+		// Payloads that aren't attribute lists are not descended into.
+		{off: 36, path: []uint16{3}},
+		{off: 44, path: nil},
+		{off: -1, path: nil},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.path, attributePath(b, tt.off), "offset %d", tt.off)
+	}
+}
@@ -0,0 +1,198 @@
+package netfilter
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/mdlayher/netlink"
+)
+
+// AttributeKind describes the expected payload of an Attribute within a Policy.
+// The values are modeled after the kernel's NLA_* policy types.
+type AttributeKind uint8
+
+// Attribute kinds known to a Policy, see include/net/netlink.h.
+const (
+	KindUnspec AttributeKind = iota // NLA_UNSPEC
+	KindU8                          // NLA_U8
+	KindU16                         // NLA_U16
+	KindU32                         // NLA_U32
+	KindU64                         // NLA_U64
+	KindString                      // NLA_STRING
+	KindBinary                      // NLA_BINARY
+	KindNested                      // NLA_NESTED
+)
+
+// AttributePolicy describes the expected shape of a single attribute type,
+// similar to a kernel struct nla_policy.
+//
+// MinLen and MaxLen bound the length of the payload in bytes and are ignored
+// when zero. They are only considered for KindUnspec, KindString and KindBinary;
+// the integer kinds require an exact payload length. For KindString, the
+// length excludes any trailing NUL byte. Nested holds the Policy applied to the
+// children of a KindNested attribute and may be nil.
+type AttributePolicy struct {
+	Kind AttributeKind
+
+	MinLen int
+	MaxLen int
+
+	// Whether the attribute must be present in the list of attributes.
+	Required bool
+
+	Nested Policy
+}
+
+// Policy maps attribute types to their expected shape. Attribute types that
+// don't appear in a Policy are accepted without validation, like the kernel's
+// liberal (non-strict) parsing mode.
+type Policy map[uint16]AttributePolicy
+
+// A PolicyError is returned when a list of Attributes does not conform to a
+// Policy. Path holds the types of the attributes leading up to and including
+// the offending attribute, starting at the top level.
+type PolicyError struct {
+	Path []uint16
+	Err  error
+}
+
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("attribute %s: %v", formatPath(e.Path), e.Err)
+}
+
+// Unwrap returns the underlying error, for use with errors.Is and errors.As.
+func (e *PolicyError) Unwrap() error {
+	return e.Err
+}
+
+// Validate checks attrs against the Policy and returns a *PolicyError
+// describing the first violation found.
+func (p Policy) Validate(attrs []Attribute) error {
+	return p.validate(nil, attrs)
+}
+
+func (p Policy) validate(path []uint16, attrs []Attribute) error {
+	seen := make(map[uint16]bool, len(p))
+
+	for _, a := range attrs {
+		ap, ok := p[a.Type]
+		if !ok {
+			continue
+		}
+		seen[a.Type] = true
+
+		if err := ap.check(a); err != nil {
+			return &PolicyError{Path: appendPath(path, a.Type), Err: err}
+		}
+
+		if ap.Kind == KindNested && ap.Nested != nil {
+			if err := ap.Nested.validate(appendPath(path, a.Type), a.Children); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Report the lowest missing attribute type for a stable result.
+	var missing []uint16
+	for t, ap := range p {
+		if ap.Required && !seen[t] {
+			missing = append(missing, t)
+		}
+	}
+	if len(missing) != 0 {
+		return &PolicyError{Path: appendPath(path, slices.Min(missing)), Err: ErrAttributeMissing}
+	}
+
+	return nil
+}
+
+// check validates a single Attribute against the AttributePolicy,
+// not descending into its children.
+func (ap AttributePolicy) check(a Attribute) error {
+	if ap.Kind == KindNested {
+		if !a.hasChildren() {
+			return ErrAttributeNotNested
+		}
+		return nil
+	}
+
+	if a.Nested {
+		return ErrAttributeNested
+	}
+
+	l := len(a.Data)
+
+	switch ap.Kind {
+	case KindU8:
+		return checkLen(l, 1, 1)
+	case KindU16:
+		return checkLen(l, 2, 2)
+	case KindU32:
+		return checkLen(l, 4, 4)
+	case KindU64:
+		return checkLen(l, 8, 8)
+	case KindString:
+		l = len(bytes.TrimRight(a.Data, "\x00"))
+	}
+
+	return checkLen(l, ap.MinLen, ap.MaxLen)
+}
+
+// checkLen returns ErrAttributeLength if l falls outside of [min, max].
+// Zero bounds are not checked.
+func checkLen(l, min, max int) error {
+	if (min != 0 && l < min) || (max != 0 && l > max) {
+		return ErrAttributeLength
+	}
+	return nil
+}
+
+// appendPath returns a copy of path with t appended, so sibling errors
+// never share a backing array.
+func appendPath(path []uint16, t uint16) []uint16 {
+	out := make([]uint16, len(path), len(path)+1)
+	copy(out, path)
+	return append(out, t)
+}
+
+// formatPath renders a path of attribute types separated by slashes.
+func formatPath(path []uint16) string {
+	p := make([]string, 0, len(path))
+	for _, t := range path {
+		p = append(p, fmt.Sprint(t))
+	}
+
+	return strings.Join(p, "/")
+}
+
+// UnmarshalAttributesWithPolicy unmarshals a byte slice into a list of
+// Attributes and validates them against p.
+func UnmarshalAttributesWithPolicy(b []byte, p Policy) ([]Attribute, error) {
+	attrs, err := UnmarshalAttributes(b)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.Validate(attrs); err != nil {
+		return nil, err
+	}
+
+	return attrs, nil
+}
+
+// UnmarshalNetlinkWithPolicy unmarshals a netlink.Message into a Netfilter
+// Header and Attributes and validates the Attributes against p.
+func UnmarshalNetlinkWithPolicy(msg netlink.Message, p Policy) (Header, []Attribute, error) {
+	h, attrs, err := UnmarshalNetlink(msg)
+	if err != nil {
+		return Header{}, nil, err
+	}
+
+	if err := p.Validate(attrs); err != nil {
+		return Header{}, nil, err
+	}
+
+	return h, attrs, nil
+}
@@ -0,0 +1,174 @@
+package netfilter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mdlayher/netlink"
+)
+
+var testPolicy = Policy{
+	1: {Kind: KindU8},
+	2: {Kind: KindU16},
+	3: {Kind: KindU32, Required: true},
+	4: {Kind: KindU64},
+	5: {Kind: KindString, MaxLen: 4},
+	6: {Kind: KindBinary, MinLen: 2, MaxLen: 3},
+	7: {Kind: KindNested, Nested: Policy{
+		1: {Kind: KindU16, Required: true},
+		2: {Kind: KindNested, Nested: Policy{
+			1: {Kind: KindU32},
+		}},
+	}},
+}
+
+func TestPolicyValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		attrs []Attribute
+		path  []uint16
+		err   error
+	}{
+		{
+			name: "valid",
+			attrs: []Attribute{
+				{Type: 1, Data: []byte{1}},
+				{Type: 2, Data: Uint16Bytes(2)},
+				{Type: 3, Data: Uint32Bytes(3)},
+				{Type: 4, Data: Uint64Bytes(4)},
+				{Type: 5, Data: []byte("abcd\x00")},
+				{Type: 6, Data: []byte{1, 2}},
+				{Type: 7, Nested: true, Children: []Attribute{
+					{Type: 1, Data: Uint16Bytes(1)},
+					{Type: 2, Nested: true, Children: []Attribute{
+						{Type: 1, Data: Uint32Bytes(1)},
+					}},
+				}},
+				{Type: 100, Data: []byte{1, 2, 3}},
+			},
+		},
+		{
+			name:  "missing required",
+			attrs: []Attribute{{Type: 1, Data: []byte{1}}},
+			path:  []uint16{3},
+			err:   ErrAttributeMissing,
+		},
+		{
+			name: "wrong integer length",
+			attrs: []Attribute{
+				{Type: 3, Data: Uint32Bytes(3)},
+				{Type: 2, Data: []byte{1}},
+			},
+			path: []uint16{2},
+			err:  ErrAttributeLength,
+		},
+		{
+			name: "string too long",
+			attrs: []Attribute{
+				{Type: 3, Data: Uint32Bytes(3)},
+				{Type: 5, Data: []byte("abcde\x00")},
+			},
+			path: []uint16{5},
+			err:  ErrAttributeLength,
+		},
+		{
+			name: "binary too short",
+			attrs: []Attribute{
+				{Type: 3, Data: Uint32Bytes(3)},
+				{Type: 6, Data: []byte{1}},
+			},
+			path: []uint16{6},
+			err:  ErrAttributeLength,
+		},
+		{
+			name: "scalar is nested",
+			attrs: []Attribute{
+				{Type: 3, Nested: true},
+			},
+			path: []uint16{3},
+			err:  ErrAttributeNested,
+		},
+		{
+			name: "nested is scalar",
+			attrs: []Attribute{
+				{Type: 3, Data: Uint32Bytes(3)},
+				{Type: 7, Data: []byte{1, 2, 3, 4}},
+			},
+			path: []uint16{7},
+			err:  ErrAttributeNotNested,
+		},
+		{
+			name: "missing in nested",
+			attrs: []Attribute{
+				{Type: 3, Data: Uint32Bytes(3)},
+				{Type: 7, Nested: true},
+			},
+			path: []uint16{7, 1},
+			err:  ErrAttributeMissing,
+		},
+		{
+			name: "invalid in second level",
+			attrs: []Attribute{
+				{Type: 3, Data: Uint32Bytes(3)},
+				{Type: 7, Nested: true, Children: []Attribute{
+					{Type: 1, Data: Uint16Bytes(1)},
+					{Type: 2, Nested: true, Children: []Attribute{
+						{Type: 1, Data: Uint16Bytes(1)},
+					}},
+				}},
+			},
+			path: []uint16{7, 2, 1},
+			err:  ErrAttributeLength,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := testPolicy.Validate(tt.attrs)
+			if tt.err == nil {
+				require.NoError(t, err)
+				return
+			}
+
+			var pe *PolicyError
+			require.ErrorAs(t, err, &pe)
+			assert.Equal(t, tt.path, pe.Path)
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
+
+func TestPolicyErrorString(t *testing.T) {
+	err := &PolicyError{Path: []uint16{7, 2, 1}, Err: ErrAttributeLength}
+	assert.EqualError(t, err, "attribute 7/2/1: unexpected attribute length")
+}
+
+func TestUnmarshalWithPolicy(t *testing.T) {
+	b, err := MarshalAttributes([]Attribute{{Type: 2, Data: Uint16Bytes(1)}})
+	require.NoError(t, err)
+
+	_, err = UnmarshalAttributesWithPolicy(b, Policy{2: {Kind: KindU16}})
+	require.NoError(t, err)
+
+	_, err = UnmarshalAttributesWithPolicy(b, Policy{2: {Kind: KindU32}})
+	assert.ErrorIs(t, err, ErrAttributeLength)
+
+	_, err = UnmarshalAttributesWithPolicy([]byte{4, 0, 0}, nil)
+	assert.Error(t, err)
+
+	msg, err := MarshalNetlink(Header{SubsystemID: NFSubsysCTNetlink}, []Attribute{{Type: 2, Data: Uint16Bytes(1)}})
+	require.NoError(t, err)
+
+	h, attrs, err := UnmarshalNetlinkWithPolicy(msg, Policy{2: {Kind: KindU16, Required: true}})
+	require.NoError(t, err)
+	assert.Equal(t, NFSubsysCTNetlink, h.SubsystemID)
+	assert.Len(t, attrs, 1)
+
+	_, _, err = UnmarshalNetlinkWithPolicy(msg, Policy{3: {Required: true}})
+	assert.ErrorIs(t, err, ErrAttributeMissing)
+
+	_, _, err = UnmarshalNetlinkWithPolicy(netlink.Message{}, nil)
+	assert.Error(t, err)
+}
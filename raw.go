@@ -0,0 +1,198 @@
+package netfilter
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/mdlayher/netlink"
+	"github.com/mdlayher/netlink/nlenc"
+	"golang.org/x/sys/unix"
+)
+
+// Attributes of an extended acknowledgement, see enum nlmsgerr_attrs in
+// uapi/linux/netlink.h.
+const (
+	nlmsgerrAttrMsg  = 1 // NLMSGERR_ATTR_MSG
+	nlmsgerrAttrOffs = 2 // NLMSGERR_ATTR_OFFS
+)
+
+// errShortMessage is returned when the kernel sends a truncated netlink message.
+var errShortMessage = errors.New("short netlink message")
+
+// receiveRaw reads a single datagram from the Conn's socket and returns the
+// netlink messages it contains. Unlike netlink.Conn.Receive, it does not turn
+// error messages into errors, so callers can correlate them with the request
+// they belong to using their sequence numbers, see ackError.
+func (c *Conn) receiveRaw() ([]netlink.Message, error) {
+	if c.recvRaw != nil {
+		return c.recvRaw()
+	}
+
+	rc, err := c.conn.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		b    []byte
+		rerr error
+	)
+
+	// Peek at the size of the next datagram before reading it, so the buffer
+	// can be sized accordingly.
+	err = rc.Read(func(fd uintptr) bool {
+		var n int
+		n, _, rerr = unix.Recvfrom(int(fd), nil, unix.MSG_PEEK|unix.MSG_TRUNC|unix.MSG_DONTWAIT)
+		if rerr == unix.EAGAIN {
+			// Wait for the socket to become readable.
+			return false
+		}
+		if rerr != nil {
+			return true
+		}
+
+		b = make([]byte, n)
+		n, _, rerr = unix.Recvfrom(int(fd), b, unix.MSG_DONTWAIT)
+		b = b[:n]
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if rerr != nil {
+		return nil, rerr
+	}
+
+	return parseMessages(b)
+}
+
+// pending reports whether a datagram is waiting to be read from the Conn's
+// socket, without consuming it. Any pending receive buffer overrun error is
+// cleared.
+func (c *Conn) pending() (bool, error) {
+	if c.pendingRaw != nil {
+		return c.pendingRaw()
+	}
+
+	rc, err := c.conn.SyscallConn()
+	if err != nil {
+		return false, err
+	}
+
+	var rerr error
+	err = rc.Control(func(fd uintptr) {
+		// Overrun errors are reported and cleared by the first read, even
+		// when peeking. Peek again to find out if any data is queued.
+		for {
+			_, _, rerr = unix.Recvfrom(int(fd), nil, unix.MSG_PEEK|unix.MSG_TRUNC|unix.MSG_DONTWAIT)
+			if rerr != unix.ENOBUFS {
+				return
+			}
+		}
+	})
+	if err != nil {
+		return false, err
+	}
+
+	switch rerr {
+	case nil:
+		return true, nil
+	case unix.EAGAIN:
+		return false, nil
+	}
+
+	return false, rerr
+}
+
+// parseMessages splits a netlink datagram into its messages. The messages'
+// Data alias b.
+func parseMessages(b []byte) ([]netlink.Message, error) {
+	var msgs []netlink.Message
+
+	for len(b) >= nlmsgHeaderLen {
+		l := int(nlenc.Uint32(b[0:4]))
+		if l < nlmsgHeaderLen || l > len(b) {
+			return nil, errShortMessage
+		}
+
+		msgs = append(msgs, netlink.Message{
+			Header: netlink.Header{
+				Length:   uint32(l),
+				Type:     netlink.HeaderType(nlenc.Uint16(b[4:6])),
+				Flags:    netlink.HeaderFlags(nlenc.Uint16(b[6:8])),
+				Sequence: nlenc.Uint32(b[8:12]),
+				PID:      nlenc.Uint32(b[12:16]),
+			},
+			Data: b[nlmsgHeaderLen:l:l],
+		})
+
+		// Messages are aligned to 4 bytes, like attributes.
+		b = b[min(nlaAlign(l), len(b)):]
+	}
+
+	return msgs, nil
+}
+
+// ackError returns the error carried by an error message (NLMSG_ERROR) as a
+// *netlink.OpError, including any extended acknowledgement. It returns nil for
+// acknowledgements and any other kind of message.
+func ackError(m netlink.Message) error {
+	if m.Header.Type != netlink.Error {
+		return nil
+	}
+
+	if len(m.Data) < 4 {
+		return &netlink.OpError{Op: "receive", Err: errShortMessage}
+	}
+
+	errno := nlenc.Int32(m.Data[0:4])
+	if errno == 0 {
+		return nil
+	}
+
+	oe := &netlink.OpError{Op: "receive", Err: unix.Errno(-errno)}
+
+	if m.Header.Flags&netlink.AcknowledgeTLVs == 0 || len(m.Data) < 4+nlmsgHeaderLen {
+		return oe
+	}
+
+	// The TLVs follow the request's netlink header, and its payload unless
+	// the kernel capped it.
+	off := 4 + nlmsgHeaderLen
+	if m.Header.Flags&netlink.Capped == 0 {
+		off = 4 + int(nlenc.Uint32(m.Data[4:8]))
+	}
+	if off > len(m.Data) {
+		return oe
+	}
+
+	it := NewAttributeIterator(m.Data[off:])
+	for it.Next() {
+		v := it.View()
+		switch v.Type() {
+		case nlmsgerrAttrMsg:
+			oe.Message = string(bytes.TrimRight(v.Data(), "\x00"))
+		case nlmsgerrAttrOffs:
+			if len(v.Data()) == 4 {
+				oe.Offset = int(nlenc.Uint32(v.Data()))
+			}
+		}
+	}
+
+	return oe
+}
+
+// doneError returns the error carried by the message terminating a multipart
+// response (NLMSG_DONE) as a *netlink.OpError. Kernels set it when a dump fails
+// after part of it has already been sent.
+func doneError(m netlink.Message) error {
+	if m.Header.Type != netlink.Done || len(m.Data) < 4 {
+		return nil
+	}
+
+	if errno := nlenc.Int32(m.Data[0:4]); errno != 0 {
+		return &netlink.OpError{Op: "receive", Err: unix.Errno(-errno)}
+	}
+
+	return nil
+}
@@ -0,0 +1,118 @@
+package netfilter
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mdlayher/netlink"
+	"github.com/mdlayher/netlink/nlenc"
+	"github.com/mdlayher/netlink/nltest"
+	"golang.org/x/sys/unix"
+)
+
+// errorMessage returns the kernel's error message (NLMSG_ERROR) in response to
+// req, an acknowledgement if errno is zero. If text is not empty, an extended
+// acknowledgement containing text and off is attached.
+func errorMessage(req netlink.Message, errno unix.Errno, text string, off int) netlink.Message {
+	b, err := req.MarshalBinary()
+	if err != nil {
+		panic(err)
+	}
+
+	m := netlink.Message{
+		Header: netlink.Header{Type: netlink.Error, Sequence: req.Header.Sequence, PID: req.Header.PID},
+		Data:   append(nlenc.Int32Bytes(-int32(errno)), b...),
+	}
+
+	if text != "" {
+		ae := netlink.NewAttributeEncoder()
+		ae.String(nlmsgerrAttrMsg, text)
+		ae.Uint32(nlmsgerrAttrOffs, uint32(off))
+		tlvs, err := ae.Encode()
+		if err != nil {
+			panic(err)
+		}
+
+		m.Header.Flags |= netlink.AcknowledgeTLVs
+		m.Data = append(m.Data, tlvs...)
+	}
+
+	return m
+}
+
+// rawTestConn returns a Conn whose raw reads are answered by calling fn with
+// the messages sent since the previous read.
+func rawTestConn(fn func(req []netlink.Message) []netlink.Message) *Conn {
+	var sent []netlink.Message
+
+	c := &Conn{conn: nltest.Dial(func(req []netlink.Message) ([]netlink.Message, error) {
+		sent = append(sent, req...)
+		return nil, nil
+	})}
+
+	c.recvRaw = func() ([]netlink.Message, error) {
+		req := sent
+		sent = nil
+		if len(req) == 0 {
+			return nil, errors.New("no pending requests")
+		}
+		return fn(req), nil
+	}
+
+	return c
+}
+
+func TestParseMessages(t *testing.T) {
+	var b []byte
+	for _, m := range []netlink.Message{
+		{Header: netlink.Header{Length: 21, Type: 1, Flags: 2, Sequence: 3, PID: 4}, Data: []byte{1, 2, 3, 4, 5}},
+		{Header: netlink.Header{Length: 16, Type: netlink.Done}},
+	} {
+		b = append(b, nlenc.Uint32Bytes(m.Header.Length)...)
+		b = append(b, nlenc.Uint16Bytes(uint16(m.Header.Type))...)
+		b = append(b, nlenc.Uint16Bytes(uint16(m.Header.Flags))...)
+		b = append(b, nlenc.Uint32Bytes(m.Header.Sequence)...)
+		b = append(b, nlenc.Uint32Bytes(m.Header.PID)...)
+		b = append(b, m.Data...)
+		b = append(b, make([]byte, nlaAlign(len(b))-len(b))...)
+	}
+
+	msgs, err := parseMessages(b)
+	require.NoError(t, err)
+	require.Len(t, msgs, 2)
+	assert.Equal(t, []byte{1, 2, 3, 4, 5}, msgs[0].Data)
+	assert.Equal(t, uint32(3), msgs[0].Header.Sequence)
+	assert.Equal(t, netlink.Done, msgs[1].Header.Type)
+	assert.Empty(t, msgs[1].Data)
+
+	_, err = parseMessages(b[:20])
+	assert.ErrorIs(t, err, errShortMessage)
+}
+
+func TestAckError(t *testing.T) {
+	req := netlink.Message{Header: netlink.Header{Length: 20, Sequence: 1}, Data: []byte{0, 0, 0, 0}}
+
+	assert.NoError(t, ackError(errorMessage(req, 0, "", 0)))
+	assert.NoError(t, ackError(netlink.Message{Header: netlink.Header{Type: netlink.Done}}))
+
+	err := ackError(errorMessage(req, unix.ENOENT, "", 0))
+	assert.ErrorIs(t, err, unix.ENOENT)
+
+	var oe *netlink.OpError
+	require.ErrorAs(t, ackError(errorMessage(req, unix.EINVAL, "bad", 16)), &oe)
+	assert.Equal(t, "bad", oe.Message)
+	assert.Equal(t, 16, oe.Offset)
+	assert.ErrorIs(t, oe, unix.EINVAL)
+
+	// Capped acknowledgements only contain the request's header.
+	capped := errorMessage(netlink.Message{Header: netlink.Header{Length: 16}}, unix.EINVAL, "capped", 4)
+	capped.Header.Flags |= netlink.Capped
+	nlenc.PutUint32(capped.Data[4:8], 100)
+	require.ErrorAs(t, ackError(capped), &oe)
+	assert.Equal(t, "capped", oe.Message)
+
+	assert.ErrorIs(t, ackError(netlink.Message{Header: netlink.Header{Type: netlink.Error}}), errShortMessage)
+}
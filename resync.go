@@ -0,0 +1,279 @@
+package netfilter
+
+import (
+	"context"
+	"errors"
+	"iter"
+
+	"github.com/mdlayher/netlink"
+)
+
+// watchDumpRetries is the amount of times Watch restarts a resynchronization
+// dump that was interrupted by a concurrent change.
+const watchDumpRetries = 3
+
+// An Event is a change to the state tracked by a Cache.
+type Event struct {
+	// ChangeAdded or ChangeModified for entries created or updated, and
+	// ChangeRemoved for entries deleted.
+	Kind ChangeKind
+
+	// The message describing the entry. For removals produced by a
+	// resynchronization, this is the last message applied to the Cache for
+	// the entry.
+	Message Message
+
+	// Resync is true for events synthesized by a resynchronization, rather
+	// than received from the kernel.
+	Resync bool
+}
+
+// A Cache tracks the state of a kernel table, like the conntrack table, by
+// applying the events received for it. Entries are identified by a key
+// derived from their messages. After events were lost, the Cache can be
+// brought up to date by resynchronizing it with a dump of the table, see
+// Resync and Watch.
+//
+// A Cache is not safe for concurrent use.
+type Cache[K comparable] struct {
+	key     func(Message) K
+	deleted func(Message) bool
+
+	entries map[K]Message
+}
+
+// NewCache returns an empty Cache. key returns the key identifying the entry
+// described by a message, deleted returns true for events deleting an entry,
+// e.g. based on their MessageType.
+func NewCache[K comparable](key func(Message) K, deleted func(Message) bool) *Cache[K] {
+	return &Cache[K]{
+		key:     key,
+		deleted: deleted,
+		entries: make(map[K]Message),
+	}
+}
+
+// Len returns the amount of entries in the Cache.
+func (c *Cache[K]) Len() int {
+	return len(c.entries)
+}
+
+// Get returns the last message applied to the Cache for the entry with key k.
+func (c *Cache[K]) Get(k K) (Message, bool) {
+	m, ok := c.entries[k]
+	return m, ok
+}
+
+// All returns an iterator over the keys and messages of all entries in the
+// Cache, in no particular order.
+func (c *Cache[K]) All() iter.Seq2[K, Message] {
+	return func(yield func(K, Message) bool) {
+		for k, m := range c.entries {
+			if !yield(k, m) {
+				return
+			}
+		}
+	}
+}
+
+// Apply updates the Cache with event m and returns the resulting Event.
+// Deleting an entry that isn't in the Cache still yields a removal.
+func (c *Cache[K]) Apply(m Message) Event {
+	k := c.key(m)
+
+	if c.deleted(m) {
+		delete(c.entries, k)
+		return Event{Kind: ChangeRemoved, Message: m}
+	}
+
+	kind := ChangeAdded
+	if _, ok := c.entries[k]; ok {
+		kind = ChangeModified
+	}
+	c.entries[k] = m
+
+	return Event{Kind: kind, Message: m}
+}
+
+// Resync replaces the contents of the Cache with the entries yielded by dump,
+// typically a Conn's Dump iterator. It returns the synthetic Events turning the
+// previous contents into the new ones: additions for entries only present in
+// the dump, removals for entries missing from it and modifications for entries
+// whose attributes are not Equal. Headers aren't compared, since those of event
+// and dump messages differ in their flags and message types. If dump yields an
+// error, the Cache is left untouched and the error is returned.
+//
+// Removals are ordered after all other Events.
+func (c *Cache[K]) Resync(dump iter.Seq2[Message, error]) ([]Event, error) {
+	entries := make(map[K]Message, len(c.entries))
+	var events []Event
+
+	for m, err := range dump {
+		if err != nil {
+			return nil, err
+		}
+
+		k := c.key(m)
+		entries[k] = m
+
+		old, ok := c.entries[k]
+		switch {
+		case !ok:
+			events = append(events, Event{Kind: ChangeAdded, Message: m, Resync: true})
+		case !Equal(old.Attributes, m.Attributes):
+			events = append(events, Event{Kind: ChangeModified, Message: m, Resync: true})
+		}
+	}
+
+	for k, m := range c.entries {
+		if _, ok := entries[k]; !ok {
+			events = append(events, Event{Kind: ChangeRemoved, Message: m, Resync: true})
+		}
+	}
+
+	c.entries = entries
+
+	return events, nil
+}
+
+// Watch keeps cache up to date with a kernel table by subscribing to groups on
+// a new Conn, and sends the Events resulting from the notifications received
+// on the returned Event channel. Errors are sent on the error channel. Both
+// channels must be read from until they are closed, which happens once ctx is
+// done or a fatal error occurred. The Conns opened by Watch use config.
+//
+// Before delivering any notifications, and whenever the kernel dropped
+// notifications due to a socket overrun, Watch opens a second Conn to dump the
+// table using request req and resynchronizes cache with the result, sending the
+// synthetic Events returned by Cache.Resync. Overruns are still reported as an
+// *OverrunError on the error channel, followed by the resynchronization's
+// Events. A resynchronization failing is a fatal error.
+//
+// Notifications queued on the socket before an overrun are delivered after the
+// resynchronization triggered by it, and may briefly make the cache reflect an
+// older state of the table than the dump.
+//
+// cache must not be accessed by the caller until the Event channel is closed,
+// other than through the Events received.
+func Watch[K comparable](
+	ctx context.Context, config *netlink.Config, groups []NetlinkGroup, req netlink.Message, cache *Cache[K],
+) (<-chan Event, <-chan error, error) {
+	c, err := Dial(config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Allow ending the subscription when watch returns due to an error.
+	sctx, cancel := context.WithCancel(ctx)
+
+	msgs, errs, err := c.Subscribe(sctx, groups)
+	if err != nil {
+		cancel()
+		c.Close()
+		return nil, nil, err
+	}
+
+	dump := func(ctx context.Context) iter.Seq2[Message, error] {
+		return func(yield func(Message, error) bool) {
+			qc, err := Dial(config)
+			if err != nil {
+				yield(Message{}, err)
+				return
+			}
+			defer qc.Close()
+
+			for m, err := range qc.DumpContext(ctx, req) {
+				if !yield(m, err) {
+					return
+				}
+			}
+		}
+	}
+
+	events := make(chan Event)
+	eventErrs := make(chan error)
+
+	go func() {
+		defer close(eventErrs)
+		defer close(events)
+
+		watch(ctx, msgs, errs, dump, cache, events, eventErrs)
+
+		// Wait for the subscription to end before closing its Conn.
+		cancel()
+		for range msgs {
+		}
+		for range errs {
+		}
+		c.Close()
+	}()
+
+	return events, eventErrs, nil
+}
+
+// watch applies the notifications received on msgs to cache and sends the
+// resulting Events to events, resynchronizing cache using dump initially and
+// after every overrun reported on errs. Returns once ctx is done, msgs or errs
+// are closed, or a fatal error was sent to eventErrs.
+func watch[K comparable](
+	ctx context.Context, msgs <-chan Message, errs <-chan error, dump func(context.Context) iter.Seq2[Message, error],
+	cache *Cache[K], events chan<- Event, eventErrs chan<- error,
+) {
+	resync := func() bool {
+		var (
+			synth []Event
+			err   error
+		)
+		for attempt := 0; ; attempt++ {
+			synth, err = cache.Resync(dump(ctx))
+			if !errors.Is(err, ErrDumpInterrupted) || attempt >= watchDumpRetries {
+				break
+			}
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				send(ctx, eventErrs, err)
+			}
+			return false
+		}
+
+		for _, e := range synth {
+			if !send(ctx, events, e) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if !resync() {
+		return
+	}
+
+	for {
+		select {
+		case m, ok := <-msgs:
+			if !ok {
+				return
+			}
+			if !send(ctx, events, cache.Apply(m)) {
+				return
+			}
+
+		case err, ok := <-errs:
+			if !ok {
+				return
+			}
+			if !send(ctx, eventErrs, err) {
+				return
+			}
+
+			var oe *OverrunError
+			if errors.As(err, &oe) && !resync() {
+				return
+			}
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
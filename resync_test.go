@@ -0,0 +1,201 @@
+package netfilter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mdlayher/netlink"
+)
+
+const cacheTestDelete MessageType = 2
+
+// cacheTestMsg returns a message describing entry k with value v, deleting the
+// entry if del is set.
+func cacheTestMsg(k, v uint32, del bool) Message {
+	m := Message{
+		Header:     Header{SubsystemID: NFSubsysCTNetlink},
+		Attributes: []Attribute{{Type: 1, Data: Uint32Bytes(k)}, {Type: 2, Data: Uint32Bytes(v)}},
+	}
+	if del {
+		m.Header.MessageType = cacheTestDelete
+	}
+	return m
+}
+
+func newTestCache() *Cache[uint32] {
+	return NewCache(
+		func(m Message) uint32 { return m.Attributes[0].Uint32() },
+		func(m Message) bool { return m.Header.MessageType == cacheTestDelete },
+	)
+}
+
+// testDump returns a dump iterator yielding msgs, followed by err if not nil.
+func testDump(err error, msgs ...Message) iter.Seq2[Message, error] {
+	return func(yield func(Message, error) bool) {
+		for _, m := range msgs {
+			if !yield(m, nil) {
+				return
+			}
+		}
+		if err != nil {
+			yield(Message{}, err)
+		}
+	}
+}
+
+// eventKeys returns the kinds and keys of events as strings like "added 1".
+func eventKeys(events []Event) []string {
+	var out []string
+	for _, e := range events {
+		out = append(out, fmt.Sprintf("%s %d", e.Kind, e.Message.Attributes[0].Uint32()))
+	}
+	return out
+}
+
+func TestCacheApply(t *testing.T) {
+	c := newTestCache()
+
+	assert.Equal(t, ChangeAdded, c.Apply(cacheTestMsg(1, 1, false)).Kind)
+	assert.Equal(t, ChangeModified, c.Apply(cacheTestMsg(1, 2, false)).Kind)
+	assert.Equal(t, ChangeAdded, c.Apply(cacheTestMsg(2, 1, false)).Kind)
+	assert.Equal(t, 2, c.Len())
+
+	m, ok := c.Get(1)
+	require.True(t, ok)
+	assert.Equal(t, uint32(2), m.Attributes[1].Uint32())
+
+	e := c.Apply(cacheTestMsg(1, 0, true))
+	assert.Equal(t, ChangeRemoved, e.Kind)
+	assert.False(t, e.Resync)
+	_, ok = c.Get(1)
+	assert.False(t, ok)
+
+	var keys []uint32
+	for k := range c.All() {
+		keys = append(keys, k)
+	}
+	assert.Equal(t, []uint32{2}, keys)
+}
+
+func TestCacheResync(t *testing.T) {
+	c := newTestCache()
+	for k := range uint32(3) {
+		c.Apply(cacheTestMsg(k, k, false))
+	}
+
+	// A failing dump leaves the cache untouched.
+	errDump := errors.New("dump failed")
+	_, err := c.Resync(testDump(errDump, cacheTestMsg(5, 5, false)))
+	assert.ErrorIs(t, err, errDump)
+	assert.Equal(t, 3, c.Len())
+
+	events, err := c.Resync(testDump(nil,
+		cacheTestMsg(0, 0, false),
+		cacheTestMsg(1, 5, false),
+		cacheTestMsg(3, 3, false),
+	))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"modified 1", "added 3", "removed 2"}, eventKeys(events))
+	for _, e := range events {
+		assert.True(t, e.Resync)
+	}
+
+	assert.Equal(t, 3, c.Len())
+	_, ok := c.Get(2)
+	assert.False(t, ok)
+}
+
+func TestCacheResyncEvents(t *testing.T) {
+	c := newTestCache()
+
+	// Entries last updated by an event, whose header differs from that of the
+	// same entry in a dump.
+	for k := range uint32(2) {
+		m := cacheTestMsg(k, k, false)
+		m.Header.Flags = netlink.Request | netlink.Create
+		c.Apply(m)
+	}
+
+	var dump []Message
+	for k := range uint32(2) {
+		m := cacheTestMsg(k, k, false)
+		m.Header.Flags = netlink.Multi
+		m.Header.MessageType = 1
+		dump = append(dump, m)
+	}
+	dump[1].Attributes[1].Data = Uint32Bytes(5)
+
+	events, err := c.Resync(testDump(nil, dump...))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"modified 1"}, eventKeys(events))
+}
+
+func TestWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	msgs := make(chan Message)
+	errs := make(chan error)
+	events := make(chan Event)
+	eventErrs := make(chan error)
+
+	// The table's contents as returned by the next dump, and the amount of
+	// times the next dump is interrupted.
+	table := []Message{cacheTestMsg(1, 1, false)}
+	var interrupted, dumps int
+	dump := func(context.Context) iter.Seq2[Message, error] {
+		dumps++
+		if interrupted > 0 {
+			interrupted--
+			return testDump(&OpError{Op: "dump", Err: ErrDumpInterrupted}, table...)
+		}
+		return testDump(nil, table...)
+	}
+
+	c := newTestCache()
+	done := make(chan struct{})
+	go func() {
+		watch(ctx, msgs, errs, dump, c, events, eventErrs)
+		close(done)
+	}()
+
+	// Initial synchronization.
+	e := <-events
+	assert.Equal(t, Event{Kind: ChangeAdded, Message: table[0], Resync: true}, e)
+
+	msgs <- cacheTestMsg(2, 2, false)
+	assert.Equal(t, ChangeAdded, (<-events).Kind)
+	msgs <- cacheTestMsg(1, 1, true)
+	assert.Equal(t, ChangeRemoved, (<-events).Kind)
+
+	// Overruns are reported and trigger a resynchronization, restarting
+	// interrupted dumps.
+	table = []Message{cacheTestMsg(1, 1, false), cacheTestMsg(3, 3, false)}
+	interrupted, dumps = 2, 0
+
+	errs <- &OverrunError{Count: 1}
+	var oe *OverrunError
+	assert.ErrorAs(t, <-eventErrs, &oe)
+	assert.Equal(t, []string{"added 1", "added 3", "removed 2"}, eventKeys([]Event{<-events, <-events, <-events}))
+	assert.Equal(t, 3, dumps)
+
+	// Other errors are passed through.
+	errOther := errors.New("decode")
+	errs <- errOther
+	assert.ErrorIs(t, <-eventErrs, errOther)
+
+	// A resynchronization failing ends the watch.
+	interrupted = watchDumpRetries + 1
+	errs <- &OverrunError{Count: 2}
+	<-eventErrs
+	assert.ErrorIs(t, <-eventErrs, ErrDumpInterrupted)
+	<-done
+
+	assert.Equal(t, 2, c.Len(), "failed resync must not alter the cache")
+}
@@ -0,0 +1,99 @@
+package netfilter
+
+import (
+	"context"
+	"errors"
+
+	"github.com/mdlayher/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// Subscribe joins the Conn to the given multicast groups and starts receiving
+// events in the background. Decoded events are sent on the returned Message
+// channel, errors on the error channel. Both channels must be read from until
+// they are closed, which happens once ctx is done or a receive fails. When
+// that happens, the Conn leaves the groups again.
+//
+// Not all errors end the subscription. When the socket's receive buffer
+// overflows, the kernel drops events and an *OverrunError is sent, after which
+// events continue to be received. Events that can't be decoded are skipped and
+// reported as a *DecodeError.
+//
+// Only one subscription can be active on a Conn at a time, Subscribe returns
+// ErrSubscribed while another one hasn't ended.
+func (c *Conn) Subscribe(ctx context.Context, groups []NetlinkGroup) (<-chan Message, <-chan error, error) {
+	if !c.subscribed.CompareAndSwap(false, true) {
+		return nil, nil, ErrSubscribed
+	}
+
+	if err := c.JoinGroups(groups); err != nil {
+		c.subscribed.Store(false)
+		return nil, nil, err
+	}
+
+	msgs := make(chan Message)
+	errs := make(chan error)
+
+	go func() {
+		defer close(errs)
+		defer close(msgs)
+
+		c.subscribe(ctx, msgs, errs)
+		_ = c.LeaveGroups(groups)
+
+		// Allow a new subscription before the channels are closed.
+		c.subscribed.Store(false)
+	}()
+
+	return msgs, errs, nil
+}
+
+// subscribe receives events from the Conn's socket until ctx is done or a
+// receive fails, sending them to msgs and any errors to errs.
+func (c *Conn) subscribe(ctx context.Context, msgs chan<- Message, errs chan<- error) {
+	var overruns int
+
+	for {
+		nlms, err := c.ReceiveContext(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if errors.Is(err, unix.ENOBUFS) {
+			overruns++
+			if !send[error](ctx, errs, &OverrunError{Count: overruns}) {
+				return
+			}
+			continue
+		}
+		if err != nil {
+			send(ctx, errs, err)
+			return
+		}
+
+		for _, nlm := range nlms {
+			if !deliver(ctx, nlm, msgs, errs) {
+				return
+			}
+		}
+	}
+}
+
+// deliver decodes nlm and sends it to msgs, or sends the decoding error to
+// errs. Returns false if ctx is done before the send completes.
+func deliver(ctx context.Context, nlm netlink.Message, msgs chan<- Message, errs chan<- error) bool {
+	m, err := UnmarshalMessage(nlm)
+	if err != nil {
+		return send(ctx, errs, err)
+	}
+	return send(ctx, msgs, m)
+}
+
+// send sends v on ch, returning false if ctx is done first.
+func send[T any](ctx context.Context, ch chan<- T, v T) bool {
+	select {
+	case ch <- v:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
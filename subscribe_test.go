@@ -0,0 +1,149 @@
+package netfilter
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mdlayher/netlink"
+	"github.com/mdlayher/netlink/nltest"
+	"golang.org/x/sys/unix"
+)
+
+// eventTestConn returns a Conn receiving the given events, which are either
+// netlink.Messages or errors. Once they are exhausted, receives block until
+// ctx is done.
+func eventTestConn(ctx context.Context, events ...any) *Conn {
+	return &Conn{conn: nltest.Dial(func(req []netlink.Message) ([]netlink.Message, error) {
+		if len(events) == 0 {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+
+		e := events[0]
+		events = events[1:]
+
+		switch e := e.(type) {
+		case netlink.Message:
+			return []netlink.Message{e}, nil
+		case error:
+			return nil, e
+		}
+		panic("unexpected event type")
+	})}
+}
+
+// collect runs c.subscribe until ctx is done or it returns, and returns all
+// messages and errors it sent.
+func collect(ctx context.Context, c *Conn) ([]Message, []error) {
+	msgs := make(chan Message)
+	errs := make(chan error)
+
+	go func() {
+		defer close(errs)
+		defer close(msgs)
+		c.subscribe(ctx, msgs, errs)
+	}()
+
+	var (
+		gotMsgs []Message
+		gotErrs []error
+	)
+	for msgs != nil || errs != nil {
+		select {
+		case m, ok := <-msgs:
+			if !ok {
+				msgs = nil
+				continue
+			}
+			gotMsgs = append(gotMsgs, m)
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			gotErrs = append(gotErrs, err)
+		}
+	}
+
+	return gotMsgs, gotErrs
+}
+
+func TestConnSubscribe(t *testing.T) {
+	event, err := MarshalNetlink(Header{SubsystemID: NFSubsysCTNetlink, MessageType: 1},
+		[]Attribute{{Type: 1, Data: []byte{1}}})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errFatal := errors.New("fatal")
+	c := eventTestConn(ctx,
+		event,
+		unix.ENOBUFS,
+		netlink.Message{Data: []byte{0}},
+		unix.ENOBUFS,
+		event,
+		errFatal,
+		event,
+	)
+
+	msgs, errs := collect(ctx, c)
+
+	// Overruns and decoding errors don't end the subscription.
+	require.Len(t, msgs, 2)
+	assert.Equal(t, NFSubsysCTNetlink, msgs[0].Header.SubsystemID)
+	require.Len(t, errs, 4)
+
+	var oe *OverrunError
+	require.ErrorAs(t, errs[0], &oe)
+	assert.Equal(t, 1, oe.Count)
+	assert.ErrorIs(t, errs[0], unix.ENOBUFS)
+
+	var de *DecodeError
+	assert.ErrorAs(t, errs[1], &de)
+
+	require.ErrorAs(t, errs[2], &oe)
+	assert.Equal(t, 2, oe.Count)
+
+	assert.ErrorIs(t, errs[3], errFatal)
+}
+
+func TestConnSubscribeCancel(t *testing.T) {
+	event, err := MarshalNetlink(Header{SubsystemID: NFSubsysCTNetlink}, nil)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	c := eventTestConn(ctx, event)
+
+	msgs := make(chan Message)
+	errs := make(chan error)
+	done := make(chan struct{})
+	go func() {
+		c.subscribe(ctx, msgs, errs)
+		close(done)
+	}()
+
+	<-msgs
+	cancel()
+	<-done
+}
+
+func TestConnSubscribeNoGroups(t *testing.T) {
+	c := Conn{conn: nlConnEcho}
+
+	_, _, err := c.Subscribe(context.Background(), nil)
+	assert.ErrorIs(t, err, ErrNoMulticastGroups)
+
+	// A failed Subscribe doesn't count as an active subscription.
+	_, _, err = c.Subscribe(context.Background(), nil)
+	assert.ErrorIs(t, err, ErrNoMulticastGroups)
+
+	c.subscribed.Store(true)
+	_, _, err = c.Subscribe(context.Background(), GroupsCT)
+	assert.ErrorIs(t, err, ErrSubscribed)
+}
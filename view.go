@@ -0,0 +1,240 @@
+package netfilter
+
+import (
+	"net"
+	"net/netip"
+
+	"github.com/mdlayher/netlink"
+	"github.com/mdlayher/netlink/nlenc"
+)
+
+const (
+	// Size of a netlink attribute header (struct nlattr - 4 bytes)
+	nlaHeaderLen = 4
+
+	// Mask for the type bits of a netlink attribute header, the two leftmost
+	// bits are reserved for the Nested and NetByteOrder flags.
+	nlaTypeMask = ^uint16(netlink.Nested | netlink.NetByteOrder)
+)
+
+// nlaAlign rounds l up to a multiple of the netlink attribute alignment.
+func nlaAlign(l int) int {
+	return (l + nlaHeaderLen - 1) &^ (nlaHeaderLen - 1)
+}
+
+// An AttributeView is a read-only view of a single Netfilter attribute within
+// a larger byte slice, typically a netlink.Message's Data. Its methods mirror
+// the fields and error-returning accessors of Attribute, but don't copy or
+// allocate, except for ParseString and ParseHardwareAddr. The byte slices it
+// returns alias the underlying buffer and must not be retained beyond its
+// lifetime.
+type AttributeView struct {
+	typ  uint16
+	data []byte
+}
+
+// Type returns the attribute's type, without the Nested and NetByteOrder flags.
+func (v AttributeView) Type() uint16 {
+	return v.typ & nlaTypeMask
+}
+
+// Nested returns whether the attribute's data contains nested attributes.
+func (v AttributeView) Nested() bool {
+	return v.typ&netlink.Nested != 0
+}
+
+// NetByteOrder returns whether the attribute's data is in network byte order.
+func (v AttributeView) NetByteOrder() bool {
+	return v.typ&netlink.NetByteOrder != 0
+}
+
+// Data returns the attribute's payload, aliasing the underlying buffer.
+func (v AttributeView) Data() []byte {
+	return v.data
+}
+
+// Children returns an AttributeIterator over the attributes nested in v.
+// It will be empty if v is not a nested attribute.
+func (v AttributeView) Children() AttributeIterator {
+	if !v.Nested() {
+		return AttributeIterator{}
+	}
+
+	return NewAttributeIterator(v.data)
+}
+
+// Attribute returns a copy of v as an Attribute, recursively decoding any
+// nested attributes.
+func (v AttributeView) Attribute() (Attribute, error) {
+	a := Attribute{
+		Type:         v.Type(),
+		Data:         append([]byte{}, v.data...),
+		Nested:       v.Nested(),
+		NetByteOrder: v.NetByteOrder(),
+	}
+
+	if a.Nested {
+		children, err := UnmarshalAttributes(v.data)
+		if err != nil {
+			return Attribute{}, err
+		}
+		a.Children = children
+	}
+
+	return a, nil
+}
+
+// ParseUint16 interprets a non-nested attribute in network byte order as a uint16.
+func (v AttributeView) ParseUint16() (uint16, error) {
+	return v.attribute().ParseUint16()
+}
+
+// ParseUint32 interprets a non-nested attribute in network byte order as a uint32.
+func (v AttributeView) ParseUint32() (uint32, error) {
+	return v.attribute().ParseUint32()
+}
+
+// ParseUint64 interprets a non-nested attribute in network byte order as a uint64.
+func (v AttributeView) ParseUint64() (uint64, error) {
+	return v.attribute().ParseUint64()
+}
+
+// ParseInt32 converts the result of ParseUint32() to an int32.
+func (v AttributeView) ParseInt32() (int32, error) {
+	return v.attribute().ParseInt32()
+}
+
+// ParseInt64 converts the result of ParseUint64() to an int64.
+func (v AttributeView) ParseInt64() (int64, error) {
+	return v.attribute().ParseInt64()
+}
+
+// ParseAddr interprets a non-nested attribute as an IPv4 or IPv6 address.
+func (v AttributeView) ParseAddr() (netip.Addr, error) {
+	return v.attribute().ParseAddr()
+}
+
+// ParseString interprets a non-nested attribute as a string, up to the first NUL byte.
+func (v AttributeView) ParseString() (string, error) {
+	return v.attribute().ParseString()
+}
+
+// ParseHardwareAddr interprets a non-nested attribute as a hardware address.
+// The returned address is a copy of the attribute's data.
+func (v AttributeView) ParseHardwareAddr() (net.HardwareAddr, error) {
+	return v.attribute().ParseHardwareAddr()
+}
+
+// ParseBitfield32 interprets a non-nested attribute as a Bitfield32.
+func (v AttributeView) ParseBitfield32() (Bitfield32, error) {
+	return v.attribute().ParseBitfield32()
+}
+
+// attribute returns a shallow Attribute sharing v's data, without decoding
+// any children. It is only meant for calling Attribute's accessors.
+func (v AttributeView) attribute() Attribute {
+	return Attribute{Type: v.Type(), Data: v.data, Nested: v.Nested(), NetByteOrder: v.NetByteOrder()}
+}
+
+// An AttributeIterator walks over the netlink attributes in a byte slice
+// without copying them. Like netlink.AttributeDecoder, it must be advanced
+// using Next before accessing the first attribute:
+//
+//	it := netfilter.NewAttributeIterator(b)
+//	for it.Next() {
+//		v := it.View()
+//		...
+//	}
+//	if err := it.Err(); err != nil { ... }
+type AttributeIterator struct {
+	b   []byte
+	off int
+	cur AttributeView
+	err error
+}
+
+// NewAttributeIterator returns an AttributeIterator over the attributes in b.
+func NewAttributeIterator(b []byte) AttributeIterator {
+	return AttributeIterator{b: b, off: -1}
+}
+
+// Next advances the iterator to the next attribute. It returns false when no
+// more attributes are present or an error was encountered.
+func (it *AttributeIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+
+	// Skip over the current attribute, if any.
+	if it.off >= 0 {
+		it.off += it.size()
+	} else {
+		it.off = 0
+	}
+
+	if it.off >= len(it.b) {
+		return false
+	}
+
+	b := it.b[it.off:]
+	if len(b) < nlaHeaderLen {
+		it.err = ErrInvalidAttributeLength
+		return false
+	}
+
+	l := int(nlenc.Uint16(b[0:2]))
+	if l > len(b) || (l != 0 && l < nlaHeaderLen) {
+		it.err = ErrInvalidAttributeLength
+		return false
+	}
+
+	// Like netlink.AttributeDecoder, treat a zero length as an empty attribute.
+	if l == 0 {
+		l = nlaHeaderLen
+	}
+
+	it.cur = AttributeView{
+		typ:  nlenc.Uint16(b[2:4]),
+		data: b[nlaHeaderLen:l],
+	}
+
+	if it.cur.Nested() && it.cur.NetByteOrder() {
+		it.err = ErrInvalidAttributeFlags
+		return false
+	}
+
+	return true
+}
+
+// size returns the aligned size of the current attribute in the buffer.
+func (it *AttributeIterator) size() int {
+	return nlaAlign(nlaHeaderLen + len(it.cur.data))
+}
+
+// View returns the attribute the iterator currently points to.
+func (it *AttributeIterator) View() AttributeView {
+	return it.cur
+}
+
+// Offset returns the offset of the current attribute's header within the
+// byte slice the iterator was created with.
+func (it *AttributeIterator) Offset() int {
+	return it.off
+}
+
+// Err returns the first error encountered by Next.
+func (it *AttributeIterator) Err() error {
+	return it.err
+}
+
+// ViewNetlink returns msg's Netfilter header and an AttributeIterator over the
+// attributes contained in the message, without copying them. Messages too short
+// to hold a Netfilter header result in a *DecodeError.
+func ViewNetlink(msg netlink.Message) (Header, AttributeIterator, error) {
+	var h Header
+	if err := h.unmarshal(msg); err != nil {
+		return Header{}, AttributeIterator{}, &DecodeError{Err: err}
+	}
+
+	return h, NewAttributeIterator(msg.Data[nfHeaderLen:]), nil
+}
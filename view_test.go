@@ -0,0 +1,295 @@
+package netfilter
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mdlayher/netlink"
+)
+
+var viewTestAttrs = []Attribute{
+	{Type: 1, Nested: true, Children: []Attribute{
+		{Type: 1, Nested: true, Children: []Attribute{
+			{Type: 1, Data: []byte{10, 0, 0, 1}},
+			{Type: 2, Data: []byte{10, 0, 0, 2}},
+		}},
+		{Type: 2, Nested: true, Children: []Attribute{
+			{Type: 1, Data: []byte{6}},
+			{Type: 2, Data: Uint16Bytes(1234), NetByteOrder: true},
+			{Type: 3, Data: Uint16Bytes(80), NetByteOrder: true},
+		}},
+	}},
+	{Type: 3, Data: Uint32Bytes(0xdeadbeef)},
+	{Type: 7, Data: Uint32Bytes(300)},
+	{Type: 8, Data: Uint64Bytes(1 << 40)},
+	{Type: 9, Data: []byte{}},
+	{Type: 10, Data: []byte("ftp\x00")},
+	{Type: 11, Data: []byte{10, 0, 0, 1}},
+	{Type: 12, Data: []byte{0, 0, 0x5e, 0, 0x53, 1}},
+	{Type: 13, Data: Bitfield32Bytes(Bitfield32{Value: 1, Selector: 1})},
+}
+
+// viewTree recursively converts an AttributeIterator into Attributes, using
+// only AttributeView accessors.
+func viewTree(t *testing.T, it AttributeIterator) []Attribute {
+	t.Helper()
+
+	var attrs []Attribute
+	for it.Next() {
+		v := it.View()
+		a := Attribute{Type: v.Type(), Data: v.Data(), Nested: v.Nested(), NetByteOrder: v.NetByteOrder()}
+		if v.Nested() {
+			a.Children = viewTree(t, v.Children())
+		}
+		attrs = append(attrs, a)
+	}
+	require.NoError(t, it.Err())
+
+	return attrs
+}
+
+func TestAttributeViewTree(t *testing.T) {
+	b, err := MarshalAttributes(viewTestAttrs)
+	require.NoError(t, err)
+
+	want, err := UnmarshalAttributes(b)
+	require.NoError(t, err)
+
+	assert.Equal(t, want, viewTree(t, NewAttributeIterator(b)))
+}
+
+func TestAttributeViewAccessors(t *testing.T) {
+	b, err := MarshalAttributes(viewTestAttrs)
+	require.NoError(t, err)
+
+	it := NewAttributeIterator(b)
+
+	require.True(t, it.Next())
+	assert.Equal(t, 0, it.Offset())
+	v := it.View()
+	_, err = v.ParseUint16()
+	assert.ErrorIs(t, err, ErrAttributeNested)
+
+	a, err := v.Attribute()
+	require.NoError(t, err)
+	assert.Equal(t, mustUnmarshal(t, b)[0], a)
+
+	require.True(t, it.Next())
+	u32, err := it.View().ParseUint32()
+	require.NoError(t, err)
+	assert.Equal(t, uint32(0xdeadbeef), u32)
+	i32, err := it.View().ParseInt32()
+	require.NoError(t, err)
+	assert.Equal(t, int32(-559038737), i32)
+	_, err = it.View().ParseUint16()
+	assert.ErrorIs(t, err, ErrAttributeLength)
+	children := it.View().Children()
+	assert.False(t, children.Next())
+
+	require.True(t, it.Next())
+	require.True(t, it.Next())
+	u64, err := it.View().ParseUint64()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1<<40), u64)
+	i64, err := it.View().ParseInt64()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1<<40), i64)
+
+	require.True(t, it.Next())
+	assert.Empty(t, it.View().Data())
+
+	require.True(t, it.Next())
+	s, err := it.View().ParseString()
+	require.NoError(t, err)
+	assert.Equal(t, "ftp", s)
+
+	require.True(t, it.Next())
+	addr, err := it.View().ParseAddr()
+	require.NoError(t, err)
+	assert.Equal(t, netip.MustParseAddr("10.0.0.1"), addr)
+
+	require.True(t, it.Next())
+	hw, err := it.View().ParseHardwareAddr()
+	require.NoError(t, err)
+	assert.Equal(t, "00:00:5e:00:53:01", hw.String())
+
+	require.True(t, it.Next())
+	bf, err := it.View().ParseBitfield32()
+	require.NoError(t, err)
+	assert.Equal(t, Bitfield32{Value: 1, Selector: 1}, bf)
+
+	assert.False(t, it.Next())
+	assert.NoError(t, it.Err())
+}
+
+func mustUnmarshal(t *testing.T, b []byte) []Attribute {
+	t.Helper()
+	attrs, err := UnmarshalAttributes(b)
+	require.NoError(t, err)
+	return attrs
+}
+
+func TestAttributeIteratorErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		b    []byte
+		err  error
+	}{
+		{
+			name: "short header",
+			b:    []byte{4, 0, 0},
+			err:  ErrInvalidAttributeLength,
+		},
+		{
+			name: "length exceeds buffer",
+			b:    []byte{12, 0, 0, 0, 0, 0, 0, 0},
+			err:  ErrInvalidAttributeLength,
+		},
+		{
+			name: "length below header size",
+			b:    []byte{2, 0, 0, 0},
+			err:  ErrInvalidAttributeLength,
+		},
+		{
+			name: "nested and byte order flags",
+			b:    []byte{4, 0, 0, 192},
+			err:  ErrInvalidAttributeFlags,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			it := NewAttributeIterator(tt.b)
+			for it.Next() {
+			}
+			assert.Equal(t, tt.err, it.Err())
+			assert.False(t, it.Next())
+
+			// The regular decoder must fail on the same input.
+			_, err := UnmarshalAttributes(tt.b)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestAttributeIteratorZeroLength(t *testing.T) {
+	it := NewAttributeIterator([]byte{0, 0, 1, 0, 4, 0, 2, 0})
+
+	require.True(t, it.Next())
+	assert.Equal(t, uint16(1), it.View().Type())
+	require.True(t, it.Next())
+	assert.Equal(t, uint16(2), it.View().Type())
+	assert.Equal(t, 4, it.Offset())
+	assert.False(t, it.Next())
+	assert.NoError(t, it.Err())
+}
+
+func TestViewNetlink(t *testing.T) {
+	h := Header{SubsystemID: NFSubsysCTNetlink, MessageType: 1, Family: ProtoIPv4}
+	msg, err := MarshalNetlink(h, viewTestAttrs)
+	require.NoError(t, err)
+
+	gotH, it, err := ViewNetlink(msg)
+	require.NoError(t, err)
+	assert.Equal(t, h, gotH)
+	assert.Equal(t, mustUnmarshal(t, msg.Data[nfHeaderLen:]), viewTree(t, it))
+
+	_, _, err = ViewNetlink(netlink.Message{})
+	assert.ErrorIs(t, err, ErrMessageLen)
+
+	var de *DecodeError
+	require.ErrorAs(t, err, &de)
+	assert.Zero(t, de.Offset)
+}
+
+func TestAttributeViewNoAlloc(t *testing.T) {
+	msg, err := MarshalNetlink(Header{}, viewTestAttrs)
+	require.NoError(t, err)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		walkView(msg)
+	})
+	assert.Zero(t, allocs)
+}
+
+// walkView visits every attribute in msg and sums all 4-byte payloads.
+func walkView(msg netlink.Message) int {
+	_, it, err := ViewNetlink(msg)
+	if err != nil {
+		panic(err)
+	}
+
+	return walkIterator(it)
+}
+
+func walkIterator(it AttributeIterator) int {
+	var n int
+	for it.Next() {
+		v := it.View()
+		if v.Nested() {
+			n += walkIterator(v.Children())
+			continue
+		}
+		if len(v.Data()) != 4 {
+			continue
+		}
+		if u, err := v.ParseUint32(); err == nil {
+			n += int(u)
+		}
+	}
+	return n
+}
+
+// walkAttributes is the equivalent of walkView using UnmarshalNetlink.
+func walkAttributes(msg netlink.Message) int {
+	_, attrs, err := UnmarshalNetlink(msg)
+	if err != nil {
+		panic(err)
+	}
+
+	return walkSlice(attrs)
+}
+
+func walkSlice(attrs []Attribute) int {
+	var n int
+	for _, a := range attrs {
+		if a.Nested {
+			n += walkSlice(a.Children)
+			continue
+		}
+		if len(a.Data) != 4 {
+			continue
+		}
+		if u, err := a.ParseUint32(); err == nil {
+			n += int(u)
+		}
+	}
+	return n
+}
+
+func BenchmarkUnmarshalNetlink(b *testing.B) {
+	msg, err := MarshalNetlink(Header{}, viewTestAttrs)
+	require.NoError(b, err)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		walkAttributes(msg)
+	}
+}
+
+func BenchmarkViewNetlink(b *testing.B) {
+	msg, err := MarshalNetlink(Header{}, viewTestAttrs)
+	require.NoError(b, err)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		walkView(msg)
+	}
+}